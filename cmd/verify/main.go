@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
+)
+
+// This is an offline verifier for exported device chains, it needs no access to the service or its database.
+// Exports are read from the files given as arguments or from standard input, either as JSON lines as served by
+// `GET /signature/device/{key}/export` or as a single document with `device` and `transactions`. Every signature and
+// every chain link is verified with the same code the service audits chains with, and the audit report of every export
+// is written to standard output as one JSON line. With -ca the certificates of all device keys have to chain to the CA.
+// The exit status is 1 if any chain is broken or any certificate is not valid, and 2 if an export cannot be read.
+
+func main() {
+	log.SetFlags(0)
+
+	ca := flag.String("ca", "", "PEM encoded CA certificate chain, the certificates of all device keys have to chain to it")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-ca chain.pem] [export.jsonl ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var roots *x509.CertPool
+	if *ca != "" {
+		chain, err := os.ReadFile(*ca)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		certificates, err := cryptic.ParseCertificates(chain)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		roots = x509.NewCertPool()
+		for _, certificate := range certificates {
+			roots.AddCert(certificate)
+		}
+	}
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	valid := true
+	encoder := json.NewEncoder(os.Stdout)
+
+	for _, path := range paths {
+		report, err := verify(path, roots)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			os.Exit(2)
+		}
+
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+
+		valid = valid && report.Valid && report.CertificateError == ""
+	}
+
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// result is the audit report of an export, with the reason the device certificates are not valid if they are checked.
+type result struct {
+	signature.AuditReport
+	CertificateError string `json:"certificateError,omitempty"`
+}
+
+// verify audits the export at the path, standard input for "-", and checks the certificates of the device against the roots if there are any.
+func verify(path string, roots *x509.CertPool) (result, error) {
+	var input io.Reader = os.Stdin
+
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return result{}, err
+		}
+		defer file.Close()
+
+		input = file
+	}
+
+	device, report, err := signature.AuditExport(input)
+	if err != nil {
+		return result{}, err
+	}
+
+	verified := result{AuditReport: report}
+
+	if roots != nil {
+		if err := signature.VerifyCertificates(device, roots); err != nil {
+			verified.CertificateError = err.Error()
+		}
+	}
+
+	return verified, nil
+}
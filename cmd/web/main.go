@@ -1,38 +1,134 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/docs"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type config struct {
 	Listen       string        `envconfig:"LISTEN" required:"true"`
+	Storage      string        `default:"memory"   envconfig:"STORAGE"`
+	KeyStore     string        `default:"software" envconfig:"KEY_STORE"`
 	ReadTimeout  time.Duration `default:"5s"       envconfig:"WRITE_TIMEOUT"`
 	WriteTimeout time.Duration `default:"30s"      envconfig:"IDLE_TIMEOUT"`
 	IdleTimeout  time.Duration `default:"30s"      envconfig:"IDLE_TIMEOUT"`
+	// MasterKeys are base64 encoded AES-256 keys by their ID, e.g. `2024:<key>,2025:<key>`, MasterKeyID selects the current one.
+	MasterKeys  map[string]string `envconfig:"MASTER_KEYS"`
+	MasterKeyID string            `envconfig:"MASTER_KEY_ID"`
+	// MinRSABits and MinCurveBits are the minimum strength of device keys, weaker keys are neither generated nor imported.
+	MinRSABits   int `default:"2048" envconfig:"MIN_RSA_BITS"`
+	MinCurveBits int `default:"256"  envconfig:"MIN_CURVE_BITS"`
+	// CACertificate and CAKey are PEM files of the CA issuing device certificates, the certificate file may hold its chain after it.
+	// Device certificates are valid for CertificateValidity.
+	CACertificate       string        `envconfig:"CA_CERTIFICATE"`
+	CAKey               string        `envconfig:"CA_KEY"`
+	CertificateValidity time.Duration `default:"43800h" envconfig:"CERTIFICATE_VALIDITY"`
+	// IdempotencyWindow is the time idempotency keys of signing requests are kept for, retries after it sign again.
+	IdempotencyWindow time.Duration `default:"24h" envconfig:"IDEMPOTENCY_WINDOW"`
+	// ValidateResponses checks responses against the OpenAPI spec as well as requests, e.g. on staging, mismatches are answered with 500.
+	ValidateResponses bool `default:"false" envconfig:"VALIDATE_RESPONSES"`
+}
+
+// postgres holds the same connection settings as `cmd/migrator`, read only when STORAGE is set to "postgres".
+type postgres struct {
+	User     string `envconfig:"USER"     required:"true"`
+	Password string `envconfig:"PASSWORD" required:"true"`
+	Host     string `envconfig:"HOST"     required:"true"`
+	Database string `envconfig:"DATABASE" required:"true"`
+	SSL      string `envconfig:"SSL"      required:"true"`
+}
+
+// pkcs11 holds settings of the token private keys are kept on, read only when KEY_STORE is set to "pkcs11".
+type pkcs11 struct {
+	Module string `envconfig:"MODULE" required:"true"`
+	Token  string `envconfig:"TOKEN"  required:"true"`
+	PIN    string `envconfig:"PIN"    required:"true"`
 }
 
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the API until it is interrupted or terminated, then shuts the server down and releases the keystore and the storage.
+func run() error {
 	var config config
 	if err := envconfig.Process("", &config); err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	keyring, err := newKeyring(config)
+	if err != nil {
+		return err
+	}
+
+	keyStore, err := newKeyStore(config.KeyStore)
+	if err != nil {
+		return err
+	}
+
+	// Keystores holding a session, e.g. on a PKCS#11 token, are logged out and finalized.
+	if closer, ok := keyStore.(io.Closer); ok {
+		defer func() {
+			if err := closer.Close(); err != nil {
+				log.Print(err)
+			}
+		}()
 	}
 
-	storage := signature.NewMemory()
+	authority, err := newAuthority(config)
+	if err != nil {
+		return err
+	}
+
+	policy := cryptic.KeyPolicy{MinRSABits: config.MinRSABits, MinCurveBits: config.MinCurveBits}
+
+	storage, closeStorage, err := newStorage(config.Storage, keyStore, keyring, policy, authority)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	// Data keys wrapped with retired master keys are re-wrapped with the current one before serving.
+	rewrapped, err := storage.RotateMasterKey(context.Background(), keyring)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Master key %q in use, %d devices re-wrapped", keyring.Current(), rewrapped)
 
 	router := http.NewServeMux()
 
 	// Chain api documentation.
 	router.Handle("/", docs.NewHandler())
 
+	// Requests are validated against the spec with the paths it documents, before the prefix is stripped.
+	handler := http.StripPrefix("/signature", signature.NewHandler(storage, authority, config.IdempotencyWindow))
+
+	validator, err := signature.NewValidator(docs.Spec(), handler, config.ValidateResponses)
+	if err != nil {
+		return err
+	}
+
 	// Chain other services below...
-	router.Handle("/signature/", http.StripPrefix("/signature", signature.NewHandler(storage)))
+	router.Handle("/signature/", validator)
 	// router.Handle("/account/", http.StripPrefix("/account", account.NewHandler())
 	// router.Handle("/cart/", http.StripPrefix("/cart",  cart.NewHandler())
 	// router.Handle("/wallet/", http.StripPrefix("/wallet",  wallet.NewHandler())
@@ -50,6 +146,123 @@ func main() {
 		IdleTimeout:  config.IdleTimeout,
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Requests in flight are finished before the keystore and the storage are released.
+	shutdown := make(chan error, 1)
+
+	go func() {
+		<-ctx.Done()
+
+		timeout, cancel := context.WithTimeout(context.Background(), config.WriteTimeout)
+		defer cancel()
+
+		shutdown <- server.Shutdown(timeout)
+	}()
+
 	log.Printf("Server starting on %s", config.Listen)
-	log.Fatal(server.ListenAndServe())
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return <-shutdown
+}
+
+// newKeyring decodes the configured master keys. Without any, the in-memory storage gets a random one,
+// which is fine as its devices are lost on restart anyway, other storages refuse to start.
+func newKeyring(config config) (*signature.Keyring, error) {
+	if len(config.MasterKeys) == 0 {
+		if config.Storage != "memory" {
+			return nil, fmt.Errorf("MASTER_KEYS are required for storage %q", config.Storage)
+		}
+
+		key, err := cryptic.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+
+		return signature.NewKeyring("ephemeral", map[string][]byte{"ephemeral": key})
+	}
+
+	keys := make(map[string][]byte, len(config.MasterKeys))
+
+	for id, encoded := range config.MasterKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding master key %q: %w", id, err)
+		}
+
+		keys[id] = key
+	}
+
+	return signature.NewKeyring(config.MasterKeyID, keys)
+}
+
+// newAuthority loads the configured CA. Without one, the in-memory storage gets a generated self-signed CA, certificates
+// and CRLs fetched from an earlier run no longer chain to it. Persisted certificates would be orphaned, so other storages refuse to start.
+func newAuthority(config config) (*cryptic.CertificateAuthority, error) {
+	if config.CACertificate == "" && config.CAKey == "" {
+		if config.Storage != "memory" {
+			return nil, fmt.Errorf("CA_CERTIFICATE and CA_KEY are required for storage %q", config.Storage)
+		}
+
+		return cryptic.GenerateCertificateAuthority("Signature Service Ephemeral CA", config.CertificateValidity)
+	}
+
+	chain, err := os.ReadFile(config.CACertificate)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ca certificate: %w", err)
+	}
+
+	key, err := os.ReadFile(config.CAKey)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ca key: %w", err)
+	}
+
+	return cryptic.NewCertificateAuthority(chain, key, config.CertificateValidity)
+}
+
+// newKeyStore selects the custody of private keys by its name ("software" or "pkcs11").
+func newKeyStore(name string) (cryptic.KeyStore, error) {
+	switch name {
+	case "software":
+		return cryptic.NewSoftwareKeyStore(), nil
+	case "pkcs11":
+		var config pkcs11
+		if err := envconfig.Process("PKCS11", &config); err != nil {
+			return nil, err
+		}
+
+		return cryptic.NewPKCS11KeyStore(cryptic.PKCS11Config{Module: config.Module, Token: config.Token, PIN: config.PIN})
+	default:
+		return nil, fmt.Errorf("unknown key store %q, expected \"software\" or \"pkcs11\"", name)
+	}
+}
+
+// newStorage selects the signature storage backend by its name ("memory" or "postgres"), the returned function closes its connections.
+func newStorage(
+	name string, keyStore cryptic.KeyStore, keyring *signature.Keyring, policy cryptic.KeyPolicy, authority *cryptic.CertificateAuthority,
+) (signature.Storage, func(), error) {
+	switch name {
+	case "memory":
+		return signature.NewMemory(keyStore, keyring, policy, authority), func() {}, nil
+	case "postgres":
+		var config postgres
+		if err := envconfig.Process("PSQL", &config); err != nil {
+			return nil, nil, err
+		}
+
+		source := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=%s", config.User, config.Password, config.Host, config.Database, config.SSL)
+
+		pool, err := pgxpool.New(context.Background(), source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error connecting to postgres: %w", err)
+		}
+
+		return signature.NewPostgres(pool, keyStore, keyring, policy, authority), pool.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage %q, expected \"memory\" or \"postgres\"", name)
+	}
 }
@@ -0,0 +1,68 @@
+package cryptic_test
+
+import (
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypt(t *testing.T) {
+	t.Parallel()
+
+	key, err := cryptic.GenerateKey()
+	require.NoError(t, err, "Failed to generate key")
+	assert.Len(t, key, cryptic.KeySize, "Generated key should have AES-256 size")
+
+	ciphertext, err := cryptic.Encrypt(key, []byte("secret"), []byte("device"))
+	require.NoError(t, err, "Failed to encrypt")
+	assert.NotContains(t, string(ciphertext), "secret", "Ciphertext should not contain plaintext")
+
+	again, err := cryptic.Encrypt(key, []byte("secret"), []byte("device"))
+	require.NoError(t, err, "Failed to encrypt")
+	assert.NotEqual(t, ciphertext, again, "Every encryption should use a fresh nonce")
+
+	plaintext, err := cryptic.Decrypt(key, ciphertext, []byte("device"))
+	require.NoError(t, err, "Failed to decrypt")
+	assert.Equal(t, []byte("secret"), plaintext, "Decrypted plaintext should match")
+}
+
+func TestDecrypt_Invalid(t *testing.T) {
+	t.Parallel()
+
+	key, err := cryptic.GenerateKey()
+	require.NoError(t, err, "Failed to generate key")
+
+	other, err := cryptic.GenerateKey()
+	require.NoError(t, err, "Failed to generate key")
+
+	ciphertext, err := cryptic.Encrypt(key, []byte("secret"), []byte("device"))
+	require.NoError(t, err, "Failed to encrypt")
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name       string
+		key        []byte
+		ciphertext []byte
+		additional []byte
+		err        error
+	}{
+		{"Wrong key", other, ciphertext, []byte("device"), cryptic.ErrDecryption},
+		{"Wrong additional data", key, ciphertext, []byte("other"), cryptic.ErrDecryption},
+		{"Tampered ciphertext", key, tampered, []byte("device"), cryptic.ErrDecryption},
+		{"Truncated ciphertext", key, ciphertext[:4], []byte("device"), cryptic.ErrDecryption},
+		{"Short key", key[:16], ciphertext, []byte("device"), cryptic.ErrInvalidKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := cryptic.Decrypt(test.key, test.ciphertext, test.additional)
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package cryptic
+
+// ca.go implements a certificate authority issuing X.509 certificates for device keys and revocation lists for them.
+// The CA key is held in software, it signs certificates and CRLs only and never any transaction data.
+// A CA is either loaded from a PEM encoded certificate chain and private key or generated as self-signed root,
+// generated roots are only trusted as long as they live, which is fine for development and the in-memory storage.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// RootValidity is the validity period of generated root certificates, it outlasts the certificates they issue.
+	RootValidity = 20 * 365 * 24 * time.Hour
+	// CRLValidity is the time until the next revocation list is due, relying parties fetch a new one after it.
+	CRLValidity = 24 * time.Hour
+)
+
+// Revocation reason codes of RFC 5280, section 5.3.1.
+const (
+	ReasonSuperseded           = 4
+	ReasonCessationOfOperation = 5
+)
+
+const (
+	// serialNumberBits is the size of random serial numbers, RFC 5280 allows up to 20 octets.
+	serialNumberBits = 128
+	// certificatePEMType is the PEM block type of certificates.
+	certificatePEMType = "CERTIFICATE"
+)
+
+// CertificateAuthority issues certificates valid for the validity period and revocation lists with its key.
+// The chain holds the CA certificate first, followed by the certificates of its issuers.
+type CertificateAuthority struct {
+	chain    []*x509.Certificate
+	signer   crypto.Signer
+	validity time.Duration
+}
+
+// NewCertificateAuthority loads a CA from the PEM encoded certificate chain, CA certificate first, and its PEM or base64 encoded private key.
+// The CA certificate has to be allowed to sign certificates and CRLs, issued certificates are valid for the validity period.
+func NewCertificateAuthority(chain, private []byte, validity time.Duration) (*CertificateAuthority, error) {
+	certificates, err := ParseCertificates(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParsePrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T cannot sign", ErrInvalidPrivateKey, key)
+	}
+
+	ca := certificates[0]
+	if !ca.IsCA || ca.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != x509.KeyUsageCertSign|x509.KeyUsageCRLSign {
+		return nil, fmt.Errorf("%w, %q is no CA allowed to sign certificates and CRLs", ErrInvalidCertificate, ca.Subject)
+	}
+
+	if public, ok := signer.Public().(interface{ Equal(x crypto.PublicKey) bool }); !ok || !public.Equal(ca.PublicKey) {
+		return nil, fmt.Errorf("%w of %q", ErrKeyMismatch, ca.Subject)
+	}
+
+	return &CertificateAuthority{chain: certificates, signer: signer, validity: validity}, nil
+}
+
+// GenerateCertificateAuthority generates a self-signed root CA with an ECDSA P-384 key, it issues certificates valid for the validity period.
+func GenerateCertificateAuthority(name string, validity time.Duration) (*CertificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating ca key: %w", err)
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(RootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ca certificate: %w", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+	}
+
+	return &CertificateAuthority{chain: []*x509.Certificate{certificate}, signer: key, validity: validity}, nil
+}
+
+// Certificate returns the CA certificate.
+func (c *CertificateAuthority) Certificate() *x509.Certificate {
+	return c.chain[0]
+}
+
+// ChainPEM returns the PEM encoded certificate chain of the CA, CA certificate first.
+func (c *CertificateAuthority) ChainPEM() []byte {
+	var chain []byte
+
+	for _, certificate := range c.chain {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: certificatePEMType, Bytes: certificate.Raw})...)
+	}
+
+	return chain
+}
+
+// Issue issues a PEM encoded end-entity certificate for the public key, valid from notBefore for the validity period of the CA
+// but never beyond the CA certificate. The key can only be used for digital signatures.
+func (c *CertificateAuthority) Issue(subject pkix.Name, public crypto.PublicKey, notBefore time.Time) ([]byte, error) {
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(c.validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	if template.NotAfter.After(c.Certificate().NotAfter) {
+		template.NotAfter = c.Certificate().NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.Certificate(), public, c.signer)
+	if err != nil {
+		return nil, fmt.Errorf("error issuing certificate: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: certificatePEMType, Bytes: der}), nil
+}
+
+// RevocationList creates a DER encoded CRL of the revoked certificates, valid from thisUpdate for CRLValidity.
+// The CRL number has to grow with every list issued, e.g. by deriving it from the time it is issued at.
+func (c *CertificateAuthority) RevocationList(revoked []x509.RevocationListEntry, number *big.Int, thisUpdate time.Time) ([]byte, error) {
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: revoked,
+		Number:                    number,
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                thisUpdate.Add(CRLValidity),
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, template, c.Certificate(), c.signer)
+	if err != nil {
+		return nil, fmt.Errorf("error creating revocation list: %w", err)
+	}
+
+	return der, nil
+}
+
+// ParseCertificates decodes all PEM encoded certificates, at least one is required.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != certificatePEMType {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCertificate, err)
+		}
+
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, ErrInvalidCertificate
+	}
+
+	return certificates, nil
+}
+
+// serialNumber generates a random positive serial number.
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+
+	return serial.Add(serial, big.NewInt(1)), nil
+}
@@ -0,0 +1,155 @@
+package cryptic_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCA creates a PEM encoded CA certificate with the key usage and its PEM encoded PKCS#8 private key.
+func newCA(t *testing.T, usage x509.KeyUsage, isCA bool) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              usage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private})
+}
+
+func TestCertificateAuthority_Issue(t *testing.T) {
+	t.Parallel()
+
+	authority, err := cryptic.GenerateCertificateAuthority("Test CA", 24*time.Hour)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+
+	rsaGenerator := cryptic.NewRSAGenerator()
+	rsaKey, err := rsaGenerator.Generate()
+	require.NoError(t, err)
+
+	eccGenerator := cryptic.NewECCGenerator()
+	eccKey, err := eccGenerator.Generate()
+	require.NoError(t, err)
+
+	edKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	notBefore := time.Now().UTC().Truncate(time.Second)
+
+	for _, public := range []crypto.PublicKey{rsaKey.Public, eccKey.Public, edKey} {
+		issued, err := authority.Issue(pkix.Name{CommonName: "device"}, public, notBefore)
+		require.NoError(t, err)
+
+		certificates, err := cryptic.ParseCertificates(issued)
+		require.NoError(t, err)
+		require.Len(t, certificates, 1)
+
+		certificate := certificates[0]
+		assert.Equal(t, "device", certificate.Subject.CommonName)
+		assert.Equal(t, public, certificate.PublicKey)
+		assert.Equal(t, notBefore, certificate.NotBefore.UTC())
+		assert.Equal(t, notBefore.Add(24*time.Hour), certificate.NotAfter.UTC())
+		assert.Equal(t, x509.KeyUsageDigitalSignature, certificate.KeyUsage)
+		assert.False(t, certificate.IsCA)
+
+		_, err = certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		require.NoError(t, err, "%T certificate should chain to the CA", public)
+	}
+
+	// Certificates never outlive the CA.
+	issued, err := authority.Issue(pkix.Name{CommonName: "device"}, edKey, authority.Certificate().NotAfter.Add(-time.Hour))
+	require.NoError(t, err)
+
+	certificates, err := cryptic.ParseCertificates(issued)
+	require.NoError(t, err)
+	assert.Equal(t, authority.Certificate().NotAfter, certificates[0].NotAfter)
+
+	chain, err := cryptic.ParseCertificates(authority.ChainPEM())
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{authority.Certificate()}, chain)
+}
+
+func TestCertificateAuthority_RevocationList(t *testing.T) {
+	t.Parallel()
+
+	authority, err := cryptic.GenerateCertificateAuthority("Test CA", time.Hour)
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	revoked := []x509.RevocationListEntry{
+		{SerialNumber: big.NewInt(7), RevocationTime: now.Add(-time.Hour), ReasonCode: cryptic.ReasonSuperseded},
+		{SerialNumber: big.NewInt(9), RevocationTime: now, ReasonCode: cryptic.ReasonCessationOfOperation},
+	}
+
+	der, err := authority.RevocationList(revoked, big.NewInt(42), now)
+	require.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(der)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(authority.Certificate()))
+
+	assert.Equal(t, big.NewInt(42), crl.Number)
+	assert.Equal(t, now.Add(cryptic.CRLValidity), crl.NextUpdate.UTC())
+	require.Len(t, crl.RevokedCertificateEntries, 2)
+	assert.Equal(t, big.NewInt(9), crl.RevokedCertificateEntries[1].SerialNumber)
+	assert.Equal(t, cryptic.ReasonCessationOfOperation, crl.RevokedCertificateEntries[1].ReasonCode)
+}
+
+func TestNewCertificateAuthority(t *testing.T) {
+	t.Parallel()
+
+	certificate, key := newCA(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign, true)
+
+	authority, err := cryptic.NewCertificateAuthority(certificate, key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "Test CA", authority.Certificate().Subject.CommonName)
+	assert.Equal(t, certificate, authority.ChainPEM())
+
+	_, err = cryptic.NewCertificateAuthority(certificate, key[:20], time.Hour)
+	require.ErrorIs(t, err, cryptic.ErrInvalidPrivateKey)
+
+	_, other := newCA(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign, true)
+	_, err = cryptic.NewCertificateAuthority(certificate, other, time.Hour)
+	require.ErrorIs(t, err, cryptic.ErrKeyMismatch)
+
+	leaf, key := newCA(t, x509.KeyUsageDigitalSignature, false)
+	_, err = cryptic.NewCertificateAuthority(leaf, key, time.Hour)
+	require.ErrorIs(t, err, cryptic.ErrInvalidCertificate, "End-entity certificates cannot issue")
+
+	noCRL, key := newCA(t, x509.KeyUsageCertSign, true)
+	_, err = cryptic.NewCertificateAuthority(noCRL, key, time.Hour)
+	require.ErrorIs(t, err, cryptic.ErrInvalidCertificate, "CAs have to sign CRLs too")
+
+	_, err = cryptic.NewCertificateAuthority(key, key, time.Hour)
+	require.ErrorIs(t, err, cryptic.ErrInvalidCertificate)
+}
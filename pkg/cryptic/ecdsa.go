@@ -4,10 +4,11 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
+	"math/big"
 )
 
 // ECCKeyPair is a DTO that holds ECC private and public keys.
@@ -16,18 +17,19 @@ type ECCKeyPair struct {
 	Private *ecdsa.PrivateKey
 }
 
-// ECCGenerator generates an ECC key pair.
-type ECCGenerator struct{}
+// ECCGenerator generates an ECC key pair on the Curve.
+type ECCGenerator struct {
+	Curve elliptic.Curve
+}
 
-// NewECCMarshaler creates a new ECCMarshaler.
+// NewECCGenerator creates a new ECCGenerator of DefaultCurve keys.
 func NewECCGenerator() ECCGenerator {
-	return ECCGenerator{}
+	return ECCGenerator{Curve: elliptic.P384()}
 }
 
 // Generate generates a new ECCKeyPair.
 func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	key, err := ecdsa.GenerateKey(g.Curve, rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("error generating ecdsa key: %w", err)
 	}
@@ -88,33 +90,156 @@ func (m ECCMarshaler) Unmarshal(privateKeyBytes []byte) (*ECCKeyPair, error) {
 	}, nil
 }
 
+// UnmarshalPublic takes an encoded ECC public key and transforms it into a ecdsa.PublicKey.
+func (m ECCMarshaler) UnmarshalPublic(publicKeyBytes []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parse pkix x509 public key: %w", err)
+	}
+
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return publicKey, nil
+}
+
 // ECDSASigner signs data using ECDSA with a private key.
 type ECDSASigner struct {
 	privateKey *ecdsa.PrivateKey
+	options    SignatureOptions
 }
 
-// NewECDSASigner creates a new ECDSASigner with the provided ECDSA private key.
-func NewECDSASigner(privateKey *ecdsa.PrivateKey) *ECDSASigner {
-	return &ECDSASigner{privateKey: privateKey}
+// NewECDSASigner creates a new ECDSASigner with the provided ECDSA private key signing with the hash of the options.
+func NewECDSASigner(privateKey *ecdsa.PrivateKey, options SignatureOptions) *ECDSASigner {
+	return &ECDSASigner{privateKey: privateKey, options: options}
 }
 
 // Sign signs the given data using ECDSA and returns the signature.
 func (s *ECDSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	hashed := sha256.Sum256(dataToBeSigned)
+	options, err := ECDSAOptions(s.options)
+	if err != nil {
+		return nil, err
+	}
 
-	r, sigS, err := ecdsa.Sign(rand.Reader, s.privateKey, hashed[:])
+	_, hashed, err := options.digest(dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	r, sigS, err := ecdsa.Sign(rand.Reader, s.privateKey, hashed)
 	if err != nil {
 		return nil, fmt.Errorf("error signing ecdsa: %w", err)
 	}
 
-	signature := append(r.Bytes(), sigS.Bytes()...)
+	return encodeECDSA(r, sigS, curveSize(s.privateKey.Curve), options.Encoding)
+}
 
-	return signature, nil
+// ecdsaSignature is the ASN.1 structure of DER encoded ECDSA signatures.
+type ecdsaSignature struct {
+	R, S *big.Int
 }
 
-// GenerateECDSAWithMarshal generates a new ECC key pair, marshals it to PEM format, and returns the public and private keys.
-func GenerateECDSAWithMarshal() ([]byte, []byte, error) {
-	generator := NewECCGenerator()
+// curveSize returns the size of values on the curve in bytes.
+func curveSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// encodeECDSA encodes r and s of a signature on a curve with values of size bytes in the encoding of checked options.
+func encodeECDSA(r, s *big.Int, size int, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingDER:
+		signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling ecdsa signature: %w", err)
+		}
+
+		return signature, nil
+	case EncodingP1363:
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+
+		return signature, nil
+	default:
+		return append(r.Bytes(), s.Bytes()...), nil
+	}
+}
+
+// ECDSAVerifier verifies signatures created by ECDSASigner.
+type ECDSAVerifier struct {
+	publicKey *ecdsa.PublicKey
+	options   SignatureOptions
+}
+
+// NewECDSAVerifier creates a new ECDSAVerifier with the provided ECDSA public key verifying with the hash of the options.
+func NewECDSAVerifier(publicKey *ecdsa.PublicKey, options SignatureOptions) *ECDSAVerifier {
+	return &ECDSAVerifier{publicKey: publicKey, options: options}
+}
+
+// Verify checks the ECDSA signature of the given data in the encoding of the options, it returns ErrInvalidSignature if it does not match.
+// The legacy encoding concatenates r and s without padding, so every split point allowed by the curve size is tried.
+func (v *ECDSAVerifier) Verify(signedData, signature []byte) error {
+	options, err := ECDSAOptions(v.options)
+	if err != nil {
+		return err
+	}
+
+	_, hashed, err := options.digest(signedData)
+	if err != nil {
+		return err
+	}
+
+	size := curveSize(v.publicKey.Curve)
+
+	switch options.Encoding {
+	case EncodingDER:
+		if !ecdsa.VerifyASN1(v.publicKey, hashed, signature) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	case EncodingP1363:
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(v.publicKey, hashed, r, s) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	for i := len(signature) - size; i <= size; i++ {
+		if i < 1 || i >= len(signature) {
+			continue
+		}
+
+		r, s := new(big.Int).SetBytes(signature[:i]), new(big.Int).SetBytes(signature[i:])
+		if ecdsa.Verify(v.publicKey, hashed, r, s) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// GenerateECDSAWithMarshal generates a new ECC key pair on the curve in params, marshals it to PEM format, and returns the public and private keys.
+func GenerateECDSAWithMarshal(params KeyParams) ([]byte, []byte, error) {
+	curve, err := params.curve()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	generator := ECCGenerator{Curve: curve}
 
 	keyPair, err := generator.Generate()
 	if err != nil {
@@ -132,7 +257,7 @@ func GenerateECDSAWithMarshal() ([]byte, []byte, error) {
 }
 
 // UnmarshalECDSAWithSign unmarshal the private key, signs the data using the corresponding ECDSA key, and returns the signature.
-func UnmarshalECDSAWithSign(data, private []byte) ([]byte, error) {
+func UnmarshalECDSAWithSign(data, private []byte, options SignatureOptions) ([]byte, error) {
 	marshaler := NewECCMarshaler()
 
 	keyPair, err := marshaler.Unmarshal(private)
@@ -140,7 +265,7 @@ func UnmarshalECDSAWithSign(data, private []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	signer := NewECDSASigner(keyPair.Private)
+	signer := NewECDSASigner(keyPair.Private, options)
 
 	signature, err := signer.Sign(data)
 	if err != nil {
@@ -149,3 +274,29 @@ func UnmarshalECDSAWithSign(data, private []byte) ([]byte, error) {
 
 	return signature, nil
 }
+
+// UnmarshalECDSAWithVerify unmarshal the public key and verifies the signature of data using the corresponding ECDSA key.
+func UnmarshalECDSAWithVerify(data, signature, public []byte, options SignatureOptions) error {
+	marshaler := NewECCMarshaler()
+
+	publicKey, err := marshaler.UnmarshalPublic(public)
+	if err != nil {
+		return err
+	}
+
+	verifier := NewECDSAVerifier(publicKey, options)
+
+	return verifier.Verify(data, signature)
+}
+
+// NewECCAlgorithm describes ECDSA for the algorithm registry.
+func NewECCAlgorithm() Algorithm {
+	return Algorithm{
+		Name:     "ECC",
+		Generate: GenerateECDSAWithMarshal,
+		Sign:     UnmarshalECDSAWithSign,
+		Verify:   UnmarshalECDSAWithVerify,
+		Import:   ImportECDSAWithMarshal,
+		Options:  ECDSAOptions,
+	}
+}
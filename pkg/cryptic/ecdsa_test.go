@@ -3,7 +3,6 @@ package cryptic_test
 import (
 	"crypto/ecdsa"
 	"crypto/sha256"
-	"math/big"
 	"testing"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
@@ -21,6 +20,7 @@ func TestECCGenerator_Generate(t *testing.T) {
 
 	assert.NotNil(t, keyPair.Public, "Generated public key should not be nil")
 	assert.NotNil(t, keyPair.Private, "Generated private key should not be nil")
+	assert.Equal(t, cryptic.DefaultCurve, keyPair.Public.Curve.Params().Name, "Generated key should be on the default curve")
 }
 
 func TestECCMarshaler_Marshal(t *testing.T) {
@@ -63,7 +63,7 @@ func TestECDSASigner_Sign(t *testing.T) {
 	keyPair, err := generator.Generate()
 	require.NoError(t, err, "Failed to generate ECC key pair")
 
-	signer := cryptic.NewECDSASigner(keyPair.Private)
+	signer := cryptic.NewECDSASigner(keyPair.Private, cryptic.SignatureOptions{})
 
 	data := []byte("test data")
 	signature, err := signer.Sign(data)
@@ -72,14 +72,13 @@ func TestECDSASigner_Sign(t *testing.T) {
 
 	hashed := sha256.Sum256(data)
 
-	isValid := ecdsa.Verify(keyPair.Public, hashed[:], new(big.Int).SetBytes(signature[:len(signature)/2]), new(big.Int).SetBytes(signature[len(signature)/2:]))
-	assert.True(t, isValid, "Failed to verify the signature")
+	assert.True(t, ecdsa.VerifyASN1(keyPair.Public, hashed[:], signature), "Signature should be DER encoded by default")
 }
 
 func TestGenerateECDSAWithMarshal(t *testing.T) {
 	t.Parallel()
 
-	public, private, err := cryptic.GenerateECDSAWithMarshal()
+	public, private, err := cryptic.GenerateECDSAWithMarshal(cryptic.KeyParams{})
 	require.NoError(t, err, "Failed to generate and marshal ECC keys")
 
 	assert.NotEmpty(t, public, "Generated public key should not be empty")
@@ -98,11 +97,46 @@ func TestUnmarshalECDSAWithSign(t *testing.T) {
 	require.NoError(t, err, "Failed to marshal ECC key pair")
 
 	data := []byte("test data")
-	signature, err := cryptic.UnmarshalECDSAWithSign(data, private)
+	signature, err := cryptic.UnmarshalECDSAWithSign(data, private, cryptic.SignatureOptions{})
 	require.NoError(t, err, "Failed to unmarshal and sign data")
 	assert.NotEmpty(t, signature, "Signature should not be empty")
 
 	hashed := sha256.Sum256(data)
-	isValid := ecdsa.Verify(keyPair.Public, hashed[:], new(big.Int).SetBytes(signature[:len(signature)/2]), new(big.Int).SetBytes(signature[len(signature)/2:]))
-	assert.True(t, isValid, "Failed to verify the signature")
+	assert.True(t, ecdsa.VerifyASN1(keyPair.Public, hashed[:], signature), "Failed to verify the signature")
+}
+
+func TestECDSAVerifier_Verify(t *testing.T) {
+	t.Parallel()
+
+	generator := cryptic.NewECCGenerator()
+	keyPair, err := generator.Generate()
+	require.NoError(t, err, "Failed to generate ECC key pair")
+
+	signer := cryptic.NewECDSASigner(keyPair.Private, cryptic.SignatureOptions{})
+	verifier := cryptic.NewECDSAVerifier(keyPair.Public, cryptic.SignatureOptions{})
+
+	// Signatures are signed repeatedly, so r or s shorter than the curve size are also covered.
+	for range 100 {
+		data := []byte("test data")
+		signature, err := signer.Sign(data)
+		require.NoError(t, err, "Failed to sign data")
+
+		require.NoError(t, verifier.Verify(data, signature), "Failed to verify the signature")
+		require.ErrorIs(t, verifier.Verify([]byte("other data"), signature), cryptic.ErrInvalidSignature, "Tampered data should not verify")
+	}
+}
+
+func TestUnmarshalECDSAWithVerify(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := cryptic.GenerateECDSAWithMarshal(cryptic.KeyParams{})
+	require.NoError(t, err, "Failed to generate and marshal ECC keys")
+
+	data := []byte("test data")
+	signature, err := cryptic.UnmarshalECDSAWithSign(data, private, cryptic.SignatureOptions{})
+	require.NoError(t, err, "Failed to unmarshal and sign data")
+
+	require.NoError(t, cryptic.UnmarshalECDSAWithVerify(data, signature, public, cryptic.SignatureOptions{}), "Failed to verify the signature")
+	err = cryptic.UnmarshalECDSAWithVerify(data, signature, []byte("not a key"), cryptic.SignatureOptions{})
+	require.ErrorIs(t, err, cryptic.ErrInvalidPublicKey, "Malformed key should be rejected")
 }
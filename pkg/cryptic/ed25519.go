@@ -0,0 +1,223 @@
+package cryptic
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// Ed25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type Ed25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// Ed25519Generator generates an Ed25519 key pair.
+type Ed25519Generator struct{}
+
+// NewEd25519Generator creates a new Ed25519Generator.
+func NewEd25519Generator() Ed25519Generator {
+	return Ed25519Generator{}
+}
+
+// Generate generates a new Ed25519KeyPair.
+func (g *Ed25519Generator) Generate() (*Ed25519KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating ed25519 key: %w", err)
+	}
+
+	return &Ed25519KeyPair{
+		Public:  public,
+		Private: private,
+	}, nil
+}
+
+// Ed25519Marshaler can encode and decode an Ed25519 key pair.
+type Ed25519Marshaler struct{}
+
+// NewEd25519Marshaler creates a new Ed25519Marshaler.
+func NewEd25519Marshaler() Ed25519Marshaler {
+	return Ed25519Marshaler{}
+}
+
+// Marshal takes an Ed25519KeyPair and encodes it to be written on disk.
+// It returns the PKIX public and the PKCS8 private key as a byte slice.
+func (m Ed25519Marshaler) Marshal(keyPair Ed25519KeyPair) ([]byte, []byte, error) {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(keyPair.Private)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshal pkcs8 x509 private key: %w", err)
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(keyPair.Public)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshal pkix x509 public key: %w", err)
+	}
+
+	encodedPrivate := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	encodedPublic := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return encodedPublic, encodedPrivate, nil
+}
+
+// Unmarshal assembles an Ed25519KeyPair from an encoded private key.
+func (m Ed25519Marshaler) Unmarshal(privateKeyBytes []byte) (*Ed25519KeyPair, error) {
+	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parse pkcs8 x509 private key: %w", err)
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	publicKey, _ := privateKey.Public().(ed25519.PublicKey)
+
+	return &Ed25519KeyPair{
+		Private: privateKey,
+		Public:  publicKey,
+	}, nil
+}
+
+// UnmarshalPublic takes an encoded Ed25519 public key and transforms it into an ed25519.PublicKey.
+func (m Ed25519Marshaler) UnmarshalPublic(publicKeyBytes []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parse pkix x509 public key: %w", err)
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return publicKey, nil
+}
+
+// Ed25519Signer signs data using Ed25519 with a private key.
+type Ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a new Ed25519Signer with the provided Ed25519 private key.
+func NewEd25519Signer(privateKey ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{privateKey: privateKey}
+}
+
+// Sign signs the given data using Ed25519 and returns the signature.
+// Ed25519 hashes the message itself, so the data is signed as is.
+func (s *Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	return ed25519.Sign(s.privateKey, dataToBeSigned), nil
+}
+
+// Ed25519Verifier verifies signatures created by Ed25519Signer.
+type Ed25519Verifier struct {
+	publicKey ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates a new Ed25519Verifier with the provided Ed25519 public key.
+func NewEd25519Verifier(publicKey ed25519.PublicKey) *Ed25519Verifier {
+	return &Ed25519Verifier{publicKey: publicKey}
+}
+
+// Verify checks the Ed25519 signature of the given data, it returns ErrInvalidSignature if it does not match.
+func (v *Ed25519Verifier) Verify(signedData, signature []byte) error {
+	if !ed25519.Verify(v.publicKey, signedData, signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// GenerateEd25519WithMarshal generates a new Ed25519 key pair, marshals it to PEM format, and returns the public and private keys.
+// Ed25519 keys have a fixed size, so params have to be empty.
+func GenerateEd25519WithMarshal(params KeyParams) ([]byte, []byte, error) {
+	if err := params.none(); err != nil {
+		return nil, nil, err
+	}
+
+	generator := NewEd25519Generator()
+
+	keyPair, err := generator.Generate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	marshaler := NewEd25519Marshaler()
+
+	public, private, err := marshaler.Marshal(*keyPair)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return public, private, nil
+}
+
+// UnmarshalEd25519WithSign unmarshal the private key, signs the data using the corresponding Ed25519 key, and returns the signature.
+// Ed25519 has no options to choose, so they have to be empty.
+func UnmarshalEd25519WithSign(data, private []byte, options SignatureOptions) ([]byte, error) {
+	if _, err := Ed25519Options(options); err != nil {
+		return nil, err
+	}
+
+	marshaler := NewEd25519Marshaler()
+
+	keyPair, err := marshaler.Unmarshal(private)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := NewEd25519Signer(keyPair.Private)
+
+	return signer.Sign(data)
+}
+
+// UnmarshalEd25519WithVerify unmarshal the public key and verifies the signature of data using the corresponding Ed25519 key.
+func UnmarshalEd25519WithVerify(data, signature, public []byte, options SignatureOptions) error {
+	if _, err := Ed25519Options(options); err != nil {
+		return err
+	}
+
+	marshaler := NewEd25519Marshaler()
+
+	publicKey, err := marshaler.UnmarshalPublic(public)
+	if err != nil {
+		return err
+	}
+
+	verifier := NewEd25519Verifier(publicKey)
+
+	return verifier.Verify(data, signature)
+}
+
+// NewEd25519Algorithm describes Ed25519 for the algorithm registry.
+func NewEd25519Algorithm() Algorithm {
+	return Algorithm{
+		Name:     "ED25519",
+		Generate: GenerateEd25519WithMarshal,
+		Sign:     UnmarshalEd25519WithSign,
+		Verify:   UnmarshalEd25519WithVerify,
+		Import:   ImportEd25519WithMarshal,
+		Options:  Ed25519Options,
+	}
+}
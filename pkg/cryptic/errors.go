@@ -0,0 +1,25 @@
+package cryptic
+
+// errors.go defines common error messages used across the `cryptic` package.
+// Errors are used for reporting malformed keys, signatures which do not verify, unknown algorithms, failed decryption, keys missing in keystores or too weak
+// and certificates which cannot be parsed.
+
+import "errors"
+
+var (
+	ErrInvalidPrivateKey          = errors.New("private key is not a valid PEM encoded key")
+	ErrInvalidPublicKey           = errors.New("public key is not a valid PEM encoded key")
+	ErrInvalidSignature           = errors.New("signature does not match data and public key")
+	ErrUnknownAlgorithm           = errors.New("algorithm is not registered")
+	ErrAlgorithmAlreadyRegistered = errors.New("algorithm is already registered")
+	ErrInvalidKey                 = errors.New("encryption key is not a valid AES-256 key")
+	ErrDecryption                 = errors.New("ciphertext cannot be decrypted with the key")
+	ErrKeyNotFound                = errors.New("key not found in keystore")
+	ErrTokenNotFound              = errors.New("pkcs11 token not found")
+	ErrKeyMismatch                = errors.New("key does not match the algorithm")
+	ErrWeakKey                    = errors.New("key is weaker than the minimum strength")
+	ErrNotSupported               = errors.New("operation is not supported")
+	ErrInvalidKeyParams           = errors.New("key parameters are not supported")
+	ErrInvalidSignatureOptions    = errors.New("signature options are not supported")
+	ErrInvalidCertificate         = errors.New("certificate is not a valid PEM encoded X.509 certificate")
+)
@@ -0,0 +1,128 @@
+package cryptic
+
+// import.go implements import of externally generated private keys, e.g. of devices migrated from another system.
+// Keys are accepted PEM encoded in PKCS#8, PKCS#1 or SEC 1 form or as base64 encoded PKCS#8 DER. They are checked against
+// the algorithm and the minimum strength and re-encoded the same way as generated keys of the algorithm.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// MinImportRSABits is the smallest RSA modulus accepted for imported keys.
+const MinImportRSABits = 2048
+
+// ParsePrivateKey decodes a PEM or base64 encoded private key in PKCS#8, PKCS#1 or SEC 1 form.
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	der := data
+
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	} else if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		der = decoded
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, ErrInvalidPrivateKey
+}
+
+// CheckKeyStrength checks the public key against the minimum strength: RSA keys need MinImportRSABits, ECDSA keys
+// one of the NIST curves P-256, P-384 or P-521 and Ed25519 keys are always strong enough.
+func CheckKeyStrength(public crypto.PublicKey) error {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < MinImportRSABits {
+			return fmt.Errorf("%w, RSA key has %d bits, expected at least %d", ErrWeakKey, key.N.BitLen(), MinImportRSABits)
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("%w, ECDSA curve %s is not supported", ErrWeakKey, key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+	default:
+		return ErrInvalidPublicKey
+	}
+
+	return nil
+}
+
+// ImportRSAWithMarshal checks an external RSA private key and returns it with its public key marshaled to PEM format.
+func ImportRSAWithMarshal(private []byte) ([]byte, []byte, error) {
+	key, err := parseImported[*rsa.PrivateKey](private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	marshaler := NewRSAMarshaler()
+
+	return marshaler.Marshal(RSAKeyPair{Private: key, Public: &key.PublicKey})
+}
+
+// ImportECDSAWithMarshal checks an external ECDSA private key and returns it with its public key marshaled to PEM format.
+func ImportECDSAWithMarshal(private []byte) ([]byte, []byte, error) {
+	key, err := parseImported[*ecdsa.PrivateKey](private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	marshaler := NewECCMarshaler()
+
+	return marshaler.Marshal(ECCKeyPair{Private: key, Public: &key.PublicKey})
+}
+
+// ImportEd25519WithMarshal checks an external Ed25519 private key and returns it with its public key marshaled to PEM format.
+func ImportEd25519WithMarshal(private []byte) ([]byte, []byte, error) {
+	key, err := parseImported[ed25519.PrivateKey](private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	public, _ := key.Public().(ed25519.PublicKey)
+	marshaler := NewEd25519Marshaler()
+
+	return marshaler.Marshal(Ed25519KeyPair{Private: key, Public: public})
+}
+
+// parseImported parses the private key and checks it is of the expected type and strong enough.
+func parseImported[T interface {
+	Public() crypto.PublicKey
+}](private []byte) (T, error) {
+	var empty T
+
+	parsed, err := ParsePrivateKey(private)
+	if err != nil {
+		return empty, err
+	}
+
+	key, ok := parsed.(T)
+	if !ok {
+		return empty, ErrKeyMismatch
+	}
+
+	if err := CheckKeyStrength(key.Public()); err != nil {
+		return empty, err
+	}
+
+	return key, nil
+}
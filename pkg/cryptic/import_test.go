@@ -0,0 +1,126 @@
+package cryptic_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftwareKeyStore_Import(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	eccKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		algorithm string
+		private   []byte
+	}{
+		"RSA PKCS#8":            {"RSA", pkcs8PEM(t, rsaKey)},
+		"RSA PKCS#1":            {"RSA", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})},
+		"ECC PKCS#8":            {"ECC", pkcs8PEM(t, eccKey)},
+		"ECC SEC 1":             {"ECC", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: mustSEC1(t, eccKey)})},
+		"ED25519 PKCS#8":        {"ED25519", pkcs8PEM(t, edKey)},
+		"ED25519 base64 PKCS#8": {"ED25519", []byte(base64.StdEncoding.EncodeToString(pkcs8DER(t, edKey)))},
+	}
+
+	keyStore := cryptic.NewSoftwareKeyStore()
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			handle, public, err := keyStore.Import(test.algorithm, test.private)
+			require.NoError(t, err, "Failed to import key")
+
+			signature, err := keyStore.Sign(test.algorithm, handle, []byte("data"), cryptic.SignatureOptions{})
+			require.NoError(t, err, "Failed to sign with imported key")
+
+			algorithm, err := cryptic.Lookup(test.algorithm)
+			require.NoError(t, err)
+			require.NoError(t, algorithm.Verify([]byte("data"), signature, public, cryptic.SignatureOptions{}), "Signature of imported key should verify")
+		})
+	}
+}
+
+func TestSoftwareKeyStore_ImportRejected(t *testing.T) {
+	t.Parallel()
+
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	weakECC, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		algorithm string
+		private   []byte
+		expected  error
+	}{
+		"Weak RSA key":         {"RSA", pkcs8PEM(t, weakRSA), cryptic.ErrWeakKey},
+		"Unsupported curve":    {"ECC", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: mustSEC1(t, weakECC)}), cryptic.ErrWeakKey},
+		"Mismatched algorithm": {"RSA", pkcs8PEM(t, edKey), cryptic.ErrKeyMismatch},
+		"Malformed key":        {"ECC", []byte("not a key"), cryptic.ErrInvalidPrivateKey},
+		"Unknown algorithm":    {"UNKNOWN", pkcs8PEM(t, edKey), cryptic.ErrUnknownAlgorithm},
+	}
+
+	keyStore := cryptic.NewSoftwareKeyStore()
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := keyStore.Import(test.algorithm, test.private)
+			require.ErrorIs(t, err, test.expected)
+		})
+	}
+}
+
+func TestSoftwareKeyStore_Resolve(t *testing.T) {
+	t.Parallel()
+
+	_, err := cryptic.NewSoftwareKeyStore().Resolve("ECC", []byte("handle"))
+	require.ErrorIs(t, err, cryptic.ErrNotSupported, "Software keystore has no keys to reference")
+}
+
+func pkcs8DER(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return der
+}
+
+func pkcs8PEM(t *testing.T, key any) []byte {
+	t.Helper()
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8DER(t, key)})
+}
+
+func mustSEC1(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return der
+}
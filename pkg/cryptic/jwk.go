@@ -0,0 +1,145 @@
+package cryptic
+
+// jwk.go implements the export of public keys in standard formats: JSON Web Keys (RFC 7517) and SubjectPublicKeyInfo as DER or PEM.
+// Key IDs are JWK thumbprints (RFC 7638), so they are stable for a key wherever and whenever it is exported.
+// Keys are exported as they are stored by keystores, PKCS#1 RSA keys become the SubjectPublicKeyInfo every other tool expects.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// JWK is the public JSON Web Key of an RSA, ECDSA or Ed25519 key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is a set of JSON Web Keys.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK builds the JSON Web Key of the public key, its key ID is the thumbprint.
+func NewJWK(public crypto.PublicKey) (JWK, error) {
+	var jwk JWK
+
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		jwk = JWK{Kty: "RSA", N: encodeBase64URL(key.N.Bytes()), E: encodeBase64URL(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		exchange, err := key.ECDH()
+		if err != nil {
+			return JWK{}, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+		}
+
+		// The uncompressed point is 0x04 followed by both coordinates padded to the curve size.
+		point, size := exchange.Bytes()[1:], curveSize(key.Curve)
+		jwk = JWK{Kty: "EC", Crv: key.Curve.Params().Name, X: encodeBase64URL(point[:size]), Y: encodeBase64URL(point[size:])}
+	case ed25519.PublicKey:
+		jwk = JWK{Kty: "OKP", Crv: "Ed25519", X: encodeBase64URL(key)}
+	default:
+		return JWK{}, fmt.Errorf("%w: %T cannot be exported", ErrInvalidPublicKey, public)
+	}
+
+	jwk.Kid = jwk.Thumbprint()
+
+	return jwk, nil
+}
+
+// Thumbprint returns the base64url encoded SHA-256 JWK thumbprint of the key.
+// It hashes the required members only, ordered by name, so optional members like the algorithm never change it.
+func (j JWK) Thumbprint() string {
+	members := map[string]string{"kty": j.Kty}
+
+	switch j.Kty {
+	case "RSA":
+		members["n"], members["e"] = j.N, j.E
+	case "EC":
+		members["crv"], members["x"], members["y"] = j.Crv, j.X, j.Y
+	default:
+		members["crv"], members["x"] = j.Crv, j.X
+	}
+
+	// Maps are marshaled with sorted keys and without whitespace, which is the form the thumbprint is defined on.
+	canonical, _ := json.Marshal(members)
+	sum := sha256.Sum256(canonical)
+
+	return encodeBase64URL(sum[:])
+}
+
+// JWSAlgorithm returns the JSON Web Signature algorithm of signatures the key makes with the options, empty when there is none.
+// ECDSA signatures match one only when encoded as P1363 with the hash of the curve, e.g. ES256 signs on P-256 with SHA-256.
+func JWSAlgorithm(public crypto.PublicKey, options SignatureOptions) string {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		options, err := RSAOptions(options)
+		if err != nil {
+			return ""
+		}
+
+		hash, _ := options.hash()
+		prefix := "RS"
+
+		if options.Scheme == SchemePSS {
+			prefix = "PS"
+		}
+
+		return prefix + strconv.Itoa(hash.Size()*8)
+	case *ecdsa.PublicKey:
+		options, err := ECDSAOptions(options)
+		if err != nil || options.Encoding != EncodingP1363 {
+			return ""
+		}
+
+		names := map[string]string{"P-256" + HashSHA256: "ES256", "P-384" + HashSHA384: "ES384", "P-521" + HashSHA512: "ES512"}
+
+		return names[key.Curve.Params().Name+options.Hash]
+	case ed25519.PublicKey:
+		return "EdDSA"
+	default:
+		return ""
+	}
+}
+
+// MarshalSPKI returns the DER encoded SubjectPublicKeyInfo of the public key.
+func MarshalSPKI(public crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	return der, nil
+}
+
+// MarshalSPKIPEM returns the SubjectPublicKeyInfo of the public key as `PUBLIC KEY` PEM block.
+func MarshalSPKIPEM(public crypto.PublicKey) ([]byte, error) {
+	der, err := MarshalSPKI(public)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// encodeBase64URL encodes bytes as unpadded base64url, the encoding of every binary JWK member.
+func encodeBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,133 @@
+package cryptic_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewJWK_Thumbprint(t *testing.T) {
+	t.Parallel()
+
+	// Example key of RFC 7638, section 3.1.
+	n := "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhM" +
+		"stn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5" +
+		"hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	require.NoError(t, err)
+
+	jwk, err := cryptic.NewJWK(&rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: 65537})
+	require.NoError(t, err)
+
+	assert.Equal(t, "RSA", jwk.Kty)
+	assert.Equal(t, n, jwk.N)
+	assert.Equal(t, "AQAB", jwk.E)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.Kid)
+
+	jwk.Alg, jwk.Use = "RS256", "sig"
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.Thumbprint(), "Optional members must not change the thumbprint")
+}
+
+func TestNewJWK(t *testing.T) {
+	t.Parallel()
+
+	generator := cryptic.NewECCGenerator()
+	ecc, err := generator.Generate()
+	require.NoError(t, err)
+
+	jwk, err := cryptic.NewJWK(ecc.Public)
+	require.NoError(t, err)
+	assert.Equal(t, "EC", jwk.Kty)
+	assert.Equal(t, "P-384", jwk.Crv)
+
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	require.NoError(t, err)
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	require.NoError(t, err)
+	assert.Len(t, x, 48, "Coordinates are padded to the curve size")
+	assert.True(t, ecc.Public.Equal(&ecdsa.PublicKey{Curve: ecc.Public.Curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}))
+
+	public, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	jwk, err = cryptic.NewJWK(public)
+	require.NoError(t, err)
+	assert.Equal(t, "OKP", jwk.Kty)
+	assert.Equal(t, "Ed25519", jwk.Crv)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(public), jwk.X)
+
+	again, err := cryptic.NewJWK(public)
+	require.NoError(t, err)
+	assert.Equal(t, jwk.Kid, again.Kid, "Key IDs must be stable")
+
+	_, err = cryptic.NewJWK("not a key")
+	require.ErrorIs(t, err, cryptic.ErrInvalidPublicKey)
+}
+
+func TestJWSAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	rsaGenerator := cryptic.NewRSAGenerator()
+	rsaKey, err := rsaGenerator.Generate()
+	require.NoError(t, err)
+
+	eccGenerator := cryptic.NewECCGenerator()
+	eccKey, err := eccGenerator.Generate()
+	require.NoError(t, err)
+
+	public, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		key      any
+		options  cryptic.SignatureOptions
+		expected string
+	}{
+		{rsaKey.Public, cryptic.SignatureOptions{}, "RS256"},
+		{rsaKey.Public, cryptic.SignatureOptions{Scheme: cryptic.SchemePSS, Hash: cryptic.HashSHA512}, "PS512"},
+		{eccKey.Public, cryptic.SignatureOptions{Hash: cryptic.HashSHA384, Encoding: cryptic.EncodingP1363}, "ES384"},
+		{eccKey.Public, cryptic.SignatureOptions{Hash: cryptic.HashSHA256, Encoding: cryptic.EncodingP1363}, ""},
+		{eccKey.Public, cryptic.SignatureOptions{Hash: cryptic.HashSHA384}, ""},
+		{public, cryptic.SignatureOptions{}, "EdDSA"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, cryptic.JWSAlgorithm(test.key, test.options), "%T with %+v", test.key, test.options)
+	}
+}
+
+func TestMarshalSPKIPEM(t *testing.T) {
+	t.Parallel()
+
+	generator := cryptic.NewRSAGenerator()
+	keyPair, err := generator.Generate()
+	require.NoError(t, err)
+
+	// RSA keys are stored as PKCS#1, they are exported as SubjectPublicKeyInfo.
+	marshaler := cryptic.NewRSAMarshaler()
+	public, _, err := marshaler.Marshal(*keyPair)
+	require.NoError(t, err)
+
+	parsed, err := cryptic.ParsePublicKey(public)
+	require.NoError(t, err)
+
+	encoded, err := cryptic.MarshalSPKIPEM(parsed)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(encoded)
+	require.NotNil(t, block)
+	assert.Equal(t, "PUBLIC KEY", block.Type)
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	require.NoError(t, err)
+	assert.True(t, keyPair.Public.Equal(key))
+}
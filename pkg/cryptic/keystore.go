@@ -0,0 +1,81 @@
+package cryptic
+
+// keystore.go implements the custody abstraction of private keys.
+// Callers reference private keys by handles and delegate signing to the keystore, so custodial keystores like HSMs
+// never hand out key material. The software keystore is the exception, its handles are the PEM encoded private keys.
+// Existing keys are brought in by importing private keys into software keystores or by referencing keys custodial keystores already hold.
+
+import "fmt"
+
+// KeyStore keeps private keys in custody and signs with them.
+type KeyStore interface {
+	// Generate generates a new key pair for the algorithm of the strength selected by params and returns the handle of the private key
+	// with the PEM encoded public key.
+	Generate(algorithm string, params KeyParams) (handle, public []byte, err error)
+	// Sign signs the data with the private key referenced by the handle using the scheme and hash selected by options.
+	Sign(algorithm string, handle, data []byte, options SignatureOptions) ([]byte, error)
+	// Import takes custody of an external private key and returns its handle with the PEM encoded public key.
+	Import(algorithm string, private []byte) (handle, public []byte, err error)
+	// Resolve checks the key already in custody referenced by the handle and returns its PEM encoded public key.
+	Resolve(algorithm string, handle []byte) (public []byte, err error)
+}
+
+// Ensures interface is implemented.
+var _ KeyStore = SoftwareKeyStore{}
+
+// SoftwareKeyStore keeps keys in software using the algorithms of the default registry, handles are the PEM encoded private keys.
+type SoftwareKeyStore struct{}
+
+// NewSoftwareKeyStore creates a new SoftwareKeyStore.
+func NewSoftwareKeyStore() SoftwareKeyStore {
+	return SoftwareKeyStore{}
+}
+
+// Generate generates a new key pair, the handle is the PEM encoded private key.
+func (SoftwareKeyStore) Generate(algorithm string, params KeyParams) ([]byte, []byte, error) {
+	found, err := Lookup(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	public, private, err := found.Generate(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return private, public, nil
+}
+
+// Sign unmarshals the PEM encoded private key from the handle and signs the data.
+func (SoftwareKeyStore) Sign(algorithm string, handle, data []byte, options SignatureOptions) ([]byte, error) {
+	found, err := Lookup(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return found.Sign(data, handle, options)
+}
+
+// Import checks the private key against the algorithm, the handle is the private key encoded like generated ones.
+func (SoftwareKeyStore) Import(algorithm string, private []byte) ([]byte, []byte, error) {
+	found, err := Lookup(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if found.Import == nil {
+		return nil, nil, fmt.Errorf("%w: %s keys cannot be imported", ErrNotSupported, algorithm)
+	}
+
+	public, handle, err := found.Import(private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return handle, public, nil
+}
+
+// Resolve is not supported, software keys are not kept anywhere but in their handles, they are imported instead.
+func (SoftwareKeyStore) Resolve(string, []byte) ([]byte, error) {
+	return nil, fmt.Errorf("%w: software keys cannot be referenced, import the private key instead", ErrNotSupported)
+}
@@ -0,0 +1,74 @@
+package cryptic_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftwareKeyStore(t *testing.T) {
+	t.Parallel()
+
+	testKeyStore(t, cryptic.NewSoftwareKeyStore())
+}
+
+// TestPKCS11KeyStore runs against the token given by PKCS11_TEST_MODULE, PKCS11_TEST_TOKEN and PKCS11_TEST_PIN and is skipped when
+// the module is not set. A SoftHSM token is prepared with e.g.
+// `softhsm2-util --init-token --free --label signature --pin 1234 --so-pin 1234`.
+func TestPKCS11KeyStore(t *testing.T) {
+	t.Parallel()
+
+	module := os.Getenv("PKCS11_TEST_MODULE")
+	if module == "" {
+		t.Skip("PKCS11_TEST_MODULE is not set")
+	}
+
+	keyStore, err := cryptic.NewPKCS11KeyStore(cryptic.PKCS11Config{
+		Module: module,
+		Token:  os.Getenv("PKCS11_TEST_TOKEN"),
+		PIN:    os.Getenv("PKCS11_TEST_PIN"),
+	})
+	require.NoError(t, err, "Failed to open token")
+	t.Cleanup(func() { assert.NoError(t, keyStore.Close()) })
+
+	testKeyStore(t, keyStore)
+
+	_, err = keyStore.Sign("ECC", []byte("unknown"), []byte("data"), cryptic.SignatureOptions{})
+	require.ErrorIs(t, err, cryptic.ErrKeyNotFound, "Unknown handle should not be found")
+
+	handle, public, err := keyStore.Generate("ECC", cryptic.KeyParams{})
+	require.NoError(t, err, "Failed to generate key")
+
+	resolved, err := keyStore.Resolve("ECC", handle)
+	require.NoError(t, err, "Failed to resolve key kept by the token")
+	assert.Equal(t, public, resolved, "Resolved public key should match the generated one")
+
+	_, err = keyStore.Resolve("ED25519", handle)
+	require.ErrorIs(t, err, cryptic.ErrKeyMismatch, "Key of another algorithm should be refused")
+}
+
+// testKeyStore checks that signatures of every built-in algorithm made by the keystore verify with the registry.
+func testKeyStore(t *testing.T, keyStore cryptic.KeyStore) {
+	t.Helper()
+
+	for _, name := range []string{"ECC", "RSA", "ED25519"} {
+		handle, public, err := keyStore.Generate(name, cryptic.KeyParams{})
+		require.NoError(t, err, "Failed to generate %s key", name)
+		assert.NotEmpty(t, handle, "Handle of %s key should not be empty", name)
+
+		signature, err := keyStore.Sign(name, handle, []byte("data"), cryptic.SignatureOptions{})
+		require.NoError(t, err, "Failed to sign with %s key", name)
+
+		algorithm, err := cryptic.Lookup(name)
+		require.NoError(t, err)
+		require.NoError(t, algorithm.Verify([]byte("data"), signature, public, cryptic.SignatureOptions{}), "Signature of %s key should verify", name)
+		err = algorithm.Verify([]byte("other"), signature, public, cryptic.SignatureOptions{})
+		require.ErrorIs(t, err, cryptic.ErrInvalidSignature, "Signature of %s key should not verify other data", name)
+	}
+
+	_, _, err := keyStore.Generate("UNKNOWN", cryptic.KeyParams{})
+	require.ErrorIs(t, err, cryptic.ErrUnknownAlgorithm, "Unknown algorithm should be refused")
+}
@@ -0,0 +1,152 @@
+package cryptic
+
+// params.go implements the parameters selecting the strength of keys and the policy of the minimum strength accepted.
+// RSA keys are generated with 2048, 3072 or 4096 bit moduli and ECDSA keys on the NIST curves P-256, P-384 or P-521.
+// The policy is checked against the actual public key, so generated, imported and referenced keys are treated the same.
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+)
+
+const (
+	// DefaultRSABits is the modulus size of RSA keys generated without explicit parameters.
+	DefaultRSABits = 2048
+	// DefaultCurve is the curve of ECDSA keys generated without explicit parameters.
+	DefaultCurve = "P-384"
+	// ed25519Bits is the strength Ed25519 keys count with for the policy, comparable to P-256.
+	ed25519Bits = 256
+)
+
+var (
+	// RSABits are the modulus sizes RSA keys can be generated with.
+	RSABits = []int{2048, 3072, 4096}
+	// Curves are the names of the curves ECDSA keys can be generated on.
+	Curves = []string{"P-256", "P-384", "P-521"}
+)
+
+// KeyParams selects the strength of a generated key, zero values select the defaults of the algorithm.
+// Bits apply to RSA keys and Curve to ECDSA keys only.
+type KeyParams struct {
+	Bits  int
+	Curve string
+}
+
+// rsaBits returns the modulus size of RSA keys, it returns ErrInvalidKeyParams for sizes which cannot be generated.
+func (p KeyParams) rsaBits() (int, error) {
+	if p.Curve != "" {
+		return 0, fmt.Errorf("%w: RSA keys have no curve", ErrInvalidKeyParams)
+	}
+
+	if p.Bits == 0 {
+		return DefaultRSABits, nil
+	}
+
+	if !slices.Contains(RSABits, p.Bits) {
+		return 0, fmt.Errorf("%w: RSA keys can have %v bits", ErrInvalidKeyParams, RSABits)
+	}
+
+	return p.Bits, nil
+}
+
+// curve returns the curve of ECDSA keys, it returns ErrInvalidKeyParams for curves keys cannot be generated on.
+func (p KeyParams) curve() (elliptic.Curve, error) {
+	if p.Bits != 0 {
+		return nil, fmt.Errorf("%w: ECDSA key sizes are given by the curve", ErrInvalidKeyParams)
+	}
+
+	switch p.Curve {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "", "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("%w: ECDSA keys can be on %v", ErrInvalidKeyParams, Curves)
+	}
+}
+
+// none checks no parameters are given for algorithms without any.
+func (p KeyParams) none() error {
+	if p != (KeyParams{}) {
+		return fmt.Errorf("%w: key has no bits or curve to choose", ErrInvalidKeyParams)
+	}
+
+	return nil
+}
+
+// KeyParamsOf returns the parameters of the public key, the modulus size of RSA keys and the curve of ECDSA keys.
+func KeyParamsOf(public crypto.PublicKey) KeyParams {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return KeyParams{Bits: key.N.BitLen()}
+	case *ecdsa.PublicKey:
+		return KeyParams{Curve: key.Curve.Params().Name}
+	default:
+		return KeyParams{}
+	}
+}
+
+// ParsePublicKey decodes a PEM encoded public key as returned by keystores, PKCS#1 for RSA and PKIX for the others.
+func ParsePublicKey(public []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(public)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	return key, nil
+}
+
+// KeyPolicy is the minimum strength of keys a service accepts on top of the keys the package supports.
+type KeyPolicy struct {
+	// MinRSABits is the smallest modulus of RSA keys.
+	MinRSABits int
+	// MinCurveBits is the smallest size of elliptic curves, Ed25519 counts as 256 bits.
+	MinCurveBits int
+}
+
+// DefaultKeyPolicy accepts every key the package supports.
+func DefaultKeyPolicy() KeyPolicy {
+	return KeyPolicy{MinRSABits: MinImportRSABits, MinCurveBits: 256}
+}
+
+// Check checks the public key against the policy, it returns ErrWeakKey for keys below the minimum strength.
+func (p KeyPolicy) Check(public crypto.PublicKey) error {
+	if err := CheckKeyStrength(public); err != nil {
+		return err
+	}
+
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < p.MinRSABits {
+			return fmt.Errorf("%w, RSA key has %d bits, the policy requires at least %d", ErrWeakKey, key.N.BitLen(), p.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().BitSize < p.MinCurveBits {
+			return fmt.Errorf("%w, curve %s has %d bits, the policy requires at least %d", ErrWeakKey, key.Curve.Params().Name, key.Curve.Params().BitSize, p.MinCurveBits)
+		}
+	case ed25519.PublicKey:
+		if ed25519Bits < p.MinCurveBits {
+			return fmt.Errorf("%w, Ed25519 counts as %d bits, the policy requires at least %d", ErrWeakKey, ed25519Bits, p.MinCurveBits)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package cryptic_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftwareKeyStore_GenerateParams(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		algorithm string
+		params    cryptic.KeyParams
+		expected  cryptic.KeyParams
+	}{
+		"RSA default":   {"RSA", cryptic.KeyParams{}, cryptic.KeyParams{Bits: 2048}},
+		"RSA 3072 bits": {"RSA", cryptic.KeyParams{Bits: 3072}, cryptic.KeyParams{Bits: 3072}},
+		"ECC default":   {"ECC", cryptic.KeyParams{}, cryptic.KeyParams{Curve: "P-384"}},
+		"ECC P-256":     {"ECC", cryptic.KeyParams{Curve: "P-256"}, cryptic.KeyParams{Curve: "P-256"}},
+		"ECC P-521":     {"ECC", cryptic.KeyParams{Curve: "P-521"}, cryptic.KeyParams{Curve: "P-521"}},
+		"ED25519":       {"ED25519", cryptic.KeyParams{}, cryptic.KeyParams{}},
+	}
+
+	keyStore := cryptic.NewSoftwareKeyStore()
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			handle, public, err := keyStore.Generate(test.algorithm, test.params)
+			require.NoError(t, err, "Failed to generate key")
+
+			key, err := cryptic.ParsePublicKey(public)
+			require.NoError(t, err, "Failed to parse public key")
+			assert.Equal(t, test.expected, cryptic.KeyParamsOf(key))
+
+			signature, err := keyStore.Sign(test.algorithm, handle, []byte("data"), cryptic.SignatureOptions{})
+			require.NoError(t, err, "Failed to sign with generated key")
+
+			algorithm, err := cryptic.Lookup(test.algorithm)
+			require.NoError(t, err)
+			require.NoError(t, algorithm.Verify([]byte("data"), signature, public, cryptic.SignatureOptions{}), "Signature should verify")
+		})
+	}
+}
+
+func TestSoftwareKeyStore_GenerateInvalidParams(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		algorithm string
+		params    cryptic.KeyParams
+	}{
+		"RSA 512 bits":     {"RSA", cryptic.KeyParams{Bits: 512}},
+		"RSA 2049 bits":    {"RSA", cryptic.KeyParams{Bits: 2049}},
+		"RSA with curve":   {"RSA", cryptic.KeyParams{Curve: "P-256"}},
+		"ECC P-224":        {"ECC", cryptic.KeyParams{Curve: "P-224"}},
+		"ECC with bits":    {"ECC", cryptic.KeyParams{Bits: 256}},
+		"ED25519 with any": {"ED25519", cryptic.KeyParams{Curve: "P-256"}},
+	}
+
+	keyStore := cryptic.NewSoftwareKeyStore()
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, _, err := keyStore.Generate(test.algorithm, test.params)
+			require.ErrorIs(t, err, cryptic.ErrInvalidKeyParams)
+		})
+	}
+}
+
+func TestKeyPolicy_Check(t *testing.T) {
+	t.Parallel()
+
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	defaults := cryptic.DefaultKeyPolicy()
+	strict := cryptic.KeyPolicy{MinRSABits: 3072, MinCurveBits: 384}
+	lax := cryptic.KeyPolicy{MinRSABits: 512, MinCurveBits: 128}
+
+	require.NoError(t, defaults.Check(&rsa2048.PublicKey))
+	require.NoError(t, defaults.Check(&p256.PublicKey))
+	require.NoError(t, defaults.Check(edPublic))
+	require.NoError(t, strict.Check(&p384.PublicKey))
+
+	require.ErrorIs(t, strict.Check(&rsa2048.PublicKey), cryptic.ErrWeakKey, "RSA 2048 is below the strict policy")
+	require.ErrorIs(t, strict.Check(&p256.PublicKey), cryptic.ErrWeakKey, "P-256 is below the strict policy")
+	require.ErrorIs(t, strict.Check(edPublic), cryptic.ErrWeakKey, "Ed25519 is below the strict policy")
+	require.ErrorIs(t, lax.Check(&p224.PublicKey), cryptic.ErrWeakKey, "Unsupported curves are refused by any policy")
+}
@@ -0,0 +1,462 @@
+package cryptic
+
+// pkcs11.go implements a keystore on top of a PKCS#11 token, e.g. a hardware security module or SoftHSM for local development.
+// Private keys are generated on the token as sensitive, non-extractable objects and never leave it, handles are their CKA_ID.
+// Keys created on the token by other means can be referenced by their CKA_ID as well.
+// The keystore uses a single logged in session, so operations on the token are serialized.
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+const (
+	// ckmECEdwardsKeyPairGen, ckmEdDSA and ckkECEdwards are PKCS#11 v3.0 values, which are not defined by the v2.40 headers of the library.
+	ckmECEdwardsKeyPairGen = 0x00001055
+	ckmEdDSA               = 0x00001057
+	ckkECEdwards           = 0x00000040
+)
+
+var (
+	oidECPublicKey = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidP256        = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidP384        = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidP521        = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+	oidEd25519     = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// subjectPublicKeyInfo is the PKIX structure of public keys read from the token as raw EC points.
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// PKCS11Config holds settings of the token the keys are kept on.
+type PKCS11Config struct {
+	// Module is the path to the PKCS#11 library, e.g. `/usr/lib/softhsm/libsofthsm2.so`.
+	Module string
+	// Token is the label of the token.
+	Token string
+	// PIN is the user PIN of the token.
+	PIN string
+}
+
+// Ensures interfaces are implemented, the service closes keystores which are closers on shutdown.
+var (
+	_ KeyStore  = &PKCS11KeyStore{}
+	_ io.Closer = &PKCS11KeyStore{}
+)
+
+// PKCS11KeyStore keeps keys on a PKCS#11 token.
+type PKCS11KeyStore struct {
+	mu      *sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+}
+
+// NewPKCS11KeyStore loads the module and logs into the token, the keystore has to be closed when it is not used anymore.
+func NewPKCS11KeyStore(config PKCS11Config) (*PKCS11KeyStore, error) {
+	ctx := pkcs11.New(config.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("error loading pkcs11 module %q", config.Module)
+	}
+
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("error initializing pkcs11 module: %w", err)
+	}
+
+	session, err := openSession(ctx, config)
+	if err != nil {
+		_ = ctx.Finalize()
+		ctx.Destroy()
+
+		return nil, err
+	}
+
+	return &PKCS11KeyStore{mu: &sync.Mutex{}, ctx: ctx, session: session}, nil
+}
+
+// Close logs out of the token and unloads the module.
+func (k *PKCS11KeyStore) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	_ = k.ctx.Logout(k.session)
+	_ = k.ctx.CloseSession(k.session)
+
+	err := k.ctx.Finalize()
+	k.ctx.Destroy()
+
+	if err != nil {
+		return fmt.Errorf("error finalizing pkcs11 module: %w", err)
+	}
+
+	return nil
+}
+
+// Generate generates a new key pair on the token, the handle is the random CKA_ID shared by both key objects.
+func (k *PKCS11KeyStore) Generate(algorithm string, params KeyParams) ([]byte, []byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, fmt.Errorf("error generating key id: %w", err)
+	}
+
+	public := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+
+	private := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+
+	var mechanism uint
+
+	switch algorithm {
+	case "ECC":
+		curve, err := params.curve()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encoded, err := asn1.Marshal(curveOID(curve))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshal curve: %w", err)
+		}
+
+		mechanism = pkcs11.CKM_EC_KEY_PAIR_GEN
+		public = append(public, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, encoded))
+	case "RSA":
+		bits, err := params.rsaBits()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, bits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		)
+	case "ED25519":
+		if err := params.none(); err != nil {
+			return nil, nil, err
+		}
+
+		encoded, err := asn1.Marshal(oidEd25519)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshal curve: %w", err)
+		}
+
+		mechanism = ckmECEdwardsKeyPairGen
+		public = append(public, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, encoded))
+	default:
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	publicObject, _, err := k.ctx.GenerateKeyPair(k.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, public, private)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating key pair on token: %w", err)
+	}
+
+	encoded, err := k.publicKey(algorithm, publicObject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return id, encoded, nil
+}
+
+// Sign signs the data on the token with the private key referenced by the handle.
+// Signatures have the same format as signatures of the software algorithms, so they verify with the registry.
+func (k *PKCS11KeyStore) Sign(algorithm string, handle, data []byte, options SignatureOptions) ([]byte, error) {
+	var (
+		mechanism *pkcs11.Mechanism
+		err       error
+	)
+
+	message := data
+
+	switch algorithm {
+	case "ECC":
+		if options, err = ECDSAOptions(options); err != nil {
+			return nil, err
+		}
+
+		// Tokens sign the digest, so ECDSA data is hashed in software for every hash function alike.
+		_, hashed, err := options.digest(data)
+		if err != nil {
+			return nil, err
+		}
+
+		mechanism, message = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), hashed
+	case "RSA":
+		if options, err = RSAOptions(options); err != nil {
+			return nil, err
+		}
+
+		mechanism = rsaMechanism(options)
+	case "ED25519":
+		if _, err := Ed25519Options(options); err != nil {
+			return nil, err
+		}
+
+		mechanism = pkcs11.NewMechanism(ckmEdDSA, nil)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, err := k.findPrivateKey(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.ctx.SignInit(k.session, []*pkcs11.Mechanism{mechanism}, key); err != nil {
+		return nil, fmt.Errorf("error initializing signature on token: %w", err)
+	}
+
+	signature, err := k.ctx.Sign(k.session, message)
+	if err != nil {
+		return nil, fmt.Errorf("error signing on token: %w", err)
+	}
+
+	// Tokens return ECDSA signatures in IEEE P1363, r and s padded to the curve size, they are encoded as the options select.
+	if algorithm == "ECC" {
+		size := len(signature) / 2
+
+		return encodeECDSA(new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:]), size, options.Encoding)
+	}
+
+	return signature, nil
+}
+
+// rsaMechanism returns the mechanism signing with the scheme and hash of checked options, PSS salts are as long as the hash.
+func rsaMechanism(options SignatureOptions) *pkcs11.Mechanism {
+	type mechanisms struct {
+		pkcs1, pss, hash, mgf, salt uint
+	}
+
+	byHash := map[string]mechanisms{
+		HashSHA256: {pkcs11.CKM_SHA256_RSA_PKCS, pkcs11.CKM_SHA256_RSA_PKCS_PSS, pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, 32},
+		HashSHA384: {pkcs11.CKM_SHA384_RSA_PKCS, pkcs11.CKM_SHA384_RSA_PKCS_PSS, pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384, 48},
+		HashSHA512: {pkcs11.CKM_SHA512_RSA_PKCS, pkcs11.CKM_SHA512_RSA_PKCS_PSS, pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512, 64},
+	}
+
+	selected := byHash[options.Hash]
+
+	if options.Scheme == SchemePSS {
+		return pkcs11.NewMechanism(selected.pss, pkcs11.NewPSSParams(selected.hash, selected.mgf, selected.salt))
+	}
+
+	return pkcs11.NewMechanism(selected.pkcs1, nil)
+}
+
+// Import is not supported, private keys are never brought to the token from outside, reference keys it already holds instead.
+func (k *PKCS11KeyStore) Import(string, []byte) ([]byte, []byte, error) {
+	return nil, nil, fmt.Errorf("%w: private keys cannot be imported to the token, reference a key on it instead", ErrNotSupported)
+}
+
+// Resolve finds the key pair with the CKA_ID handle on the token, checks it matches the algorithm and the minimum strength
+// and returns its public key.
+func (k *PKCS11KeyStore) Resolve(algorithm string, handle []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, err := k.findObject(pkcs11.CKO_PRIVATE_KEY, handle); err != nil {
+		return nil, err
+	}
+
+	object, err := k.findObject(pkcs11.CKO_PUBLIC_KEY, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key type is checked first, reading attributes of another type of key fails without telling why.
+	attributes, err := k.ctx.GetAttributeValue(k.session, object, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil)})
+	if err != nil {
+		return nil, fmt.Errorf("error reading key type from token: %w", err)
+	}
+
+	keyTypes := map[string]uint{"RSA": pkcs11.CKK_RSA, "ECC": pkcs11.CKK_EC, "ED25519": ckkECEdwards}
+
+	// CK_ULONG values are returned in the size and byte order of the platform, the expected one is encoded the same way by the library.
+	expected, known := keyTypes[algorithm]
+	if !known || !bytes.Equal(attributes[0].Value, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, expected).Value) {
+		return nil, ErrKeyMismatch
+	}
+
+	encoded, err := k.publicKey(algorithm, object)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(encoded)
+
+	var public any
+
+	if algorithm == "RSA" {
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	if err := CheckKeyStrength(public); err != nil {
+		return nil, err
+	}
+
+	return encoded, nil
+}
+
+// curveOID returns the identifier of the ECDSA curve, as the CKA_EC_PARAMS of keys generated on the token.
+func curveOID(curve elliptic.Curve) asn1.ObjectIdentifier {
+	switch curve {
+	case elliptic.P256():
+		return oidP256
+	case elliptic.P521():
+		return oidP521
+	default:
+		return oidP384
+	}
+}
+
+// findPrivateKey finds the private key object by its CKA_ID, the caller has to hold the lock.
+func (k *PKCS11KeyStore) findPrivateKey(handle []byte) (pkcs11.ObjectHandle, error) {
+	return k.findObject(pkcs11.CKO_PRIVATE_KEY, handle)
+}
+
+// findObject finds the key object of the class by its CKA_ID, the caller has to hold the lock.
+func (k *PKCS11KeyStore) findObject(class uint, handle []byte) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, handle),
+	}
+
+	if err := k.ctx.FindObjectsInit(k.session, template); err != nil {
+		return 0, fmt.Errorf("error searching key on token: %w", err)
+	}
+
+	objects, _, err := k.ctx.FindObjects(k.session, 1)
+
+	if finalErr := k.ctx.FindObjectsFinal(k.session); err == nil && finalErr != nil {
+		err = finalErr
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("error searching key on token: %w", err)
+	}
+
+	if len(objects) == 0 {
+		return 0, ErrKeyNotFound
+	}
+
+	return objects[0], nil
+}
+
+// publicKey reads the public key object and encodes it the same way as the software algorithms do, the caller has to hold the lock.
+func (k *PKCS11KeyStore) publicKey(algorithm string, object pkcs11.ObjectHandle) ([]byte, error) {
+	if algorithm == "RSA" {
+		attributes, err := k.ctx.GetAttributeValue(k.session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading public key from token: %w", err)
+		}
+
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attributes[0].Value),
+			E: int(new(big.Int).SetBytes(attributes[1].Value).Int64()),
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA_PUBLIC_KEY", Bytes: x509.MarshalPKCS1PublicKey(key)}), nil
+	}
+
+	attributes, err := k.ctx.GetAttributeValue(k.session, object, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading public key from token: %w", err)
+	}
+
+	// The point is DER encoded as an OCTET STRING, some tokens return it raw.
+	point := attributes[0].Value
+	if rest, err := asn1.Unmarshal(attributes[0].Value, &point); err != nil || len(rest) > 0 {
+		point = attributes[0].Value
+	}
+
+	identifier := pkix.AlgorithmIdentifier{Algorithm: oidEd25519}
+
+	// The curve of ECDSA keys is taken from the key, referenced keys may use other curves than generated ones.
+	if algorithm == "ECC" {
+		identifier = pkix.AlgorithmIdentifier{Algorithm: oidECPublicKey, Parameters: asn1.RawValue{FullBytes: attributes[1].Value}}
+	}
+
+	der, err := asn1.Marshal(subjectPublicKeyInfo{Algorithm: identifier, PublicKey: asn1.BitString{Bytes: point, BitLength: len(point) * 8}})
+	if err != nil {
+		return nil, fmt.Errorf("error marshal pkix public key: %w", err)
+	}
+
+	if _, err := x509.ParsePKIXPublicKey(der); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// openSession opens a read-write session on the token with the label and logs in as user.
+func openSession(ctx *pkcs11.Ctx, config PKCS11Config) (pkcs11.SessionHandle, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("error listing pkcs11 slots: %w", err)
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil || info.Label != config.Token {
+			continue
+		}
+
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			return 0, fmt.Errorf("error opening pkcs11 session: %w", err)
+		}
+
+		if err := ctx.Login(session, pkcs11.CKU_USER, config.PIN); err != nil {
+			_ = ctx.CloseSession(session)
+			return 0, fmt.Errorf("error logging into pkcs11 token: %w", err)
+		}
+
+		return session, nil
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrTokenNotFound, config.Token)
+}
@@ -0,0 +1,110 @@
+package cryptic
+
+// registry.go implements a registry of signature algorithms looked up by their name.
+// Each algorithm bundles key generation with marshaling, signing and verification, so callers never branch on the algorithm.
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Algorithm describes a signature algorithm operating on PEM encoded keys.
+type Algorithm struct {
+	// Name identifies the algorithm, e.g. "RSA".
+	Name string
+	// Generate generates a new key pair of the strength selected by params and returns the marshaled public and private keys.
+	Generate func(params KeyParams) ([]byte, []byte, error)
+	// Sign unmarshal the private key and signs the data with the scheme and hash selected by options.
+	Sign func(data, private []byte, options SignatureOptions) ([]byte, error)
+	// Verify unmarshal the public key and verifies the signature of the data, it returns ErrInvalidSignature if it does not match.
+	Verify func(data, signature, public []byte, options SignatureOptions) error
+	// Import checks an external private key and returns the marshaled public and private keys, nil if import is not supported.
+	Import func(private []byte) ([]byte, []byte, error)
+	// Options checks signature options and fills in the defaults of the algorithm.
+	Options func(options SignatureOptions) (SignatureOptions, error)
+}
+
+// Registry holds signature algorithms by their name and is safe for concurrent use.
+type Registry struct {
+	mu         *sync.RWMutex
+	algorithms map[string]Algorithm
+}
+
+// NewRegistry creates a new Registry holding given algorithms.
+func NewRegistry(algorithms ...Algorithm) *Registry {
+	registry := &Registry{
+		mu:         &sync.RWMutex{},
+		algorithms: make(map[string]Algorithm, len(algorithms)),
+	}
+
+	for _, algorithm := range algorithms {
+		registry.algorithms[algorithm.Name] = algorithm
+	}
+
+	return registry
+}
+
+// Register adds the algorithm to the registry, names cannot be registered twice.
+func (r *Registry) Register(algorithm Algorithm) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.algorithms[algorithm.Name]; exists {
+		return fmt.Errorf("%w: %s", ErrAlgorithmAlreadyRegistered, algorithm.Name)
+	}
+
+	r.algorithms[algorithm.Name] = algorithm
+
+	return nil
+}
+
+// Lookup finds the algorithm registered under the name.
+func (r *Registry) Lookup(name string) (Algorithm, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	algorithm, exists := r.algorithms[name]
+	if !exists {
+		return Algorithm{}, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, name)
+	}
+
+	return algorithm, nil
+}
+
+// Names returns sorted names of all registered algorithms.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.algorithms))
+	for name := range r.algorithms {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// registry is the default registry holding every algorithm supported by the package.
+var registry = NewRegistry(
+	NewECCAlgorithm(),
+	NewEd25519Algorithm(),
+	NewRSAAlgorithm(),
+)
+
+// Register adds the algorithm to the default registry.
+func Register(algorithm Algorithm) error {
+	return registry.Register(algorithm)
+}
+
+// Lookup finds the algorithm registered under the name in the default registry.
+func Lookup(name string) (Algorithm, error) {
+	return registry.Lookup(name)
+}
+
+// Names returns sorted names of all algorithms in the default registry.
+func Names() []string {
+	return registry.Names()
+}
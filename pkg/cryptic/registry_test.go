@@ -0,0 +1,55 @@
+package cryptic_test
+
+import (
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	t.Parallel()
+
+	registry := cryptic.NewRegistry(cryptic.NewRSAAlgorithm())
+
+	err := registry.Register(cryptic.NewECCAlgorithm())
+	require.NoError(t, err, "Failed to register ECC algorithm")
+
+	err = registry.Register(cryptic.NewRSAAlgorithm())
+	require.ErrorIs(t, err, cryptic.ErrAlgorithmAlreadyRegistered, "Algorithm should not be registered twice")
+
+	assert.Equal(t, []string{"ECC", "RSA"}, registry.Names(), "Names should be sorted")
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	t.Parallel()
+
+	registry := cryptic.NewRegistry(cryptic.NewECCAlgorithm())
+
+	algorithm, err := registry.Lookup("ECC")
+	require.NoError(t, err, "Failed to lookup ECC algorithm")
+	assert.Equal(t, "ECC", algorithm.Name)
+
+	_, err = registry.Lookup("RSA")
+	require.ErrorIs(t, err, cryptic.ErrUnknownAlgorithm, "Unregistered algorithm should not be found")
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range cryptic.Names() {
+		algorithm, err := cryptic.Lookup(name)
+		require.NoError(t, err, "Failed to lookup %s algorithm", name)
+
+		public, private, err := algorithm.Generate(cryptic.KeyParams{})
+		require.NoError(t, err, "Failed to generate %s keys", name)
+
+		data := []byte("test data")
+		signature, err := algorithm.Sign(data, private, cryptic.SignatureOptions{})
+		require.NoError(t, err, "Failed to sign data with %s", name)
+
+		require.NoError(t, algorithm.Verify(data, signature, public, cryptic.SignatureOptions{}), "Failed to verify %s signature", name)
+		require.ErrorIs(t, algorithm.Verify([]byte("other data"), signature, public, cryptic.SignatureOptions{}), cryptic.ErrInvalidSignature)
+	}
+}
@@ -1,10 +1,8 @@
 package cryptic
 
 import (
-	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -16,18 +14,19 @@ type RSAKeyPair struct {
 	Private *rsa.PrivateKey
 }
 
-// RSAGenerator generates a RSA key pair.
-type RSAGenerator struct{}
+// RSAGenerator generates a RSA key pair with a modulus of Bits.
+type RSAGenerator struct {
+	Bits int
+}
 
+// NewRSAGenerator creates a new RSAGenerator of DefaultRSABits keys.
 func NewRSAGenerator() RSAGenerator {
-	return RSAGenerator{}
+	return RSAGenerator{Bits: DefaultRSABits}
 }
 
 // Generate generates a new RSAKeyPair.
 func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
-	bits := 512 // Security has been ignored for the sake of simplicity.
-
-	key, err := rsa.GenerateKey(rand.Reader, bits)
+	key, err := rsa.GenerateKey(rand.Reader, g.Bits)
 	if err != nil {
 		return nil, fmt.Errorf("error generating rsa key: %w", err)
 	}
@@ -79,21 +78,54 @@ func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
 	return pair, nil
 }
 
+// UnmarshalPublic takes an encoded RSA public key and transforms it into a rsa.PublicKey.
+func (m *RSAMarshaler) UnmarshalPublic(publicKeyBytes []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	publicKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing PKCS1 public key: %w", err)
+	}
+
+	return publicKey, nil
+}
+
 // RSASigner implements the Signer interface for RSA.
 type RSASigner struct {
 	privateKey *rsa.PrivateKey
+	options    SignatureOptions
 }
 
-// NewRSASigner creates a new RSASigner with the provided RSA private key.
-func NewRSASigner(privateKey *rsa.PrivateKey) *RSASigner {
-	return &RSASigner{privateKey: privateKey}
+// NewRSASigner creates a new RSASigner with the provided RSA private key signing with the scheme and hash of the options.
+func NewRSASigner(privateKey *rsa.PrivateKey, options SignatureOptions) *RSASigner {
+	return &RSASigner{privateKey: privateKey, options: options}
 }
 
 // Sign signs the given data using RSA and returns the signature.
 func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
-	hashed := sha256.Sum256(dataToBeSigned)
+	options, err := RSAOptions(s.options)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, hashed, err := options.digest(dataToBeSigned)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Scheme == SchemePSS {
+		signature, err := rsa.SignPSS(rand.Reader, s.privateKey, hash, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		if err != nil {
+			return nil, fmt.Errorf("error signing rsa PSS: %w", err)
+		}
 
-	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, hashed[:])
+		return signature, nil
+	}
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, hash, hashed)
 	if err != nil {
 		return nil, fmt.Errorf("error signing rsa PKCS1v15: %w", err)
 	}
@@ -101,9 +133,51 @@ func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 	return signature, nil
 }
 
-// GenerateRSAWithMarshal generates an RSA key pair, marshals it into PEM format, and returns the public and private keys.
-func GenerateRSAWithMarshal() ([]byte, []byte, error) {
-	generator := NewRSAGenerator()
+// RSAVerifier verifies signatures created by RSASigner.
+type RSAVerifier struct {
+	publicKey *rsa.PublicKey
+	options   SignatureOptions
+}
+
+// NewRSAVerifier creates a new RSAVerifier with the provided RSA public key verifying with the scheme and hash of the options.
+func NewRSAVerifier(publicKey *rsa.PublicKey, options SignatureOptions) *RSAVerifier {
+	return &RSAVerifier{publicKey: publicKey, options: options}
+}
+
+// Verify checks the RSA signature of the given data, it returns ErrInvalidSignature if it does not match.
+// PSS signatures are accepted with any salt length, signers other than RSASigner may choose different ones.
+func (v *RSAVerifier) Verify(signedData, signature []byte) error {
+	options, err := RSAOptions(v.options)
+	if err != nil {
+		return err
+	}
+
+	hash, hashed, err := options.digest(signedData)
+	if err != nil {
+		return err
+	}
+
+	if options.Scheme == SchemePSS {
+		err = rsa.VerifyPSS(v.publicKey, hash, hashed, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+	} else {
+		err = rsa.VerifyPKCS1v15(v.publicKey, hash, hashed, signature)
+	}
+
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// GenerateRSAWithMarshal generates an RSA key pair of the modulus size in params, marshals it into PEM format, and returns the public and private keys.
+func GenerateRSAWithMarshal(params KeyParams) ([]byte, []byte, error) {
+	bits, err := params.rsaBits()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	generator := RSAGenerator{Bits: bits}
 
 	keyPair, err := generator.Generate()
 	if err != nil {
@@ -121,7 +195,7 @@ func GenerateRSAWithMarshal() ([]byte, []byte, error) {
 }
 
 // UnmarshalRSAWithSign unmarshal the private key, signs the data using the corresponding RSA key, and returns the signature.
-func UnmarshalRSAWithSign(data, private []byte) ([]byte, error) {
+func UnmarshalRSAWithSign(data, private []byte, options SignatureOptions) ([]byte, error) {
 	marshaler := NewRSAMarshaler()
 
 	keyPair, err := marshaler.Unmarshal(private)
@@ -129,7 +203,7 @@ func UnmarshalRSAWithSign(data, private []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	signer := NewRSASigner(keyPair.Private)
+	signer := NewRSASigner(keyPair.Private, options)
 
 	signature, err := signer.Sign(data)
 	if err != nil {
@@ -138,3 +212,29 @@ func UnmarshalRSAWithSign(data, private []byte) ([]byte, error) {
 
 	return signature, nil
 }
+
+// UnmarshalRSAWithVerify unmarshal the public key and verifies the signature of data using the corresponding RSA key.
+func UnmarshalRSAWithVerify(data, signature, public []byte, options SignatureOptions) error {
+	marshaler := NewRSAMarshaler()
+
+	publicKey, err := marshaler.UnmarshalPublic(public)
+	if err != nil {
+		return err
+	}
+
+	verifier := NewRSAVerifier(publicKey, options)
+
+	return verifier.Verify(data, signature)
+}
+
+// NewRSAAlgorithm describes RSA with PKCS1v15 or PSS signatures for the algorithm registry.
+func NewRSAAlgorithm() Algorithm {
+	return Algorithm{
+		Name:     "RSA",
+		Generate: GenerateRSAWithMarshal,
+		Sign:     UnmarshalRSAWithSign,
+		Verify:   UnmarshalRSAWithVerify,
+		Import:   ImportRSAWithMarshal,
+		Options:  RSAOptions,
+	}
+}
@@ -21,6 +21,7 @@ func TestRSAGenerator_Generate(t *testing.T) {
 
 	assert.NotNil(t, keyPair.Public, "Generated public key should not be nil")
 	assert.NotNil(t, keyPair.Private, "Generated private key should not be nil")
+	assert.Equal(t, cryptic.DefaultRSABits, keyPair.Public.N.BitLen(), "Generated key should have the default size")
 }
 
 func TestRSAMarshaler_Marshal(t *testing.T) {
@@ -63,7 +64,7 @@ func TestRSASigner_Sign(t *testing.T) {
 	keyPair, err := generator.Generate()
 	require.NoError(t, err, "Failed to generate RSA key pair")
 
-	signer := cryptic.NewRSASigner(keyPair.Private)
+	signer := cryptic.NewRSASigner(keyPair.Private, cryptic.SignatureOptions{})
 
 	data := []byte("test data")
 	signature, err := signer.Sign(data)
@@ -74,7 +75,7 @@ func TestRSASigner_Sign(t *testing.T) {
 func TestGenerateRSAWithMarshal(t *testing.T) {
 	t.Parallel()
 
-	public, private, err := cryptic.GenerateRSAWithMarshal()
+	public, private, err := cryptic.GenerateRSAWithMarshal(cryptic.KeyParams{})
 	require.NoError(t, err, "Failed to generate and marshal RSA keys")
 
 	assert.NotEmpty(t, public, "Generated public key should not be empty")
@@ -93,7 +94,7 @@ func TestUnmarshalRSAWithSign(t *testing.T) {
 	require.NoError(t, err, "Failed to marshal RSA key pair")
 
 	data := []byte("test data")
-	signature, err := cryptic.UnmarshalRSAWithSign(data, private)
+	signature, err := cryptic.UnmarshalRSAWithSign(data, private, cryptic.SignatureOptions{})
 	require.NoError(t, err, "Failed to unmarshal and sign data")
 	assert.NotEmpty(t, signature, "Signature should not be empty")
 
@@ -101,3 +102,36 @@ func TestUnmarshalRSAWithSign(t *testing.T) {
 	err = rsa.VerifyPKCS1v15(keyPair.Public, crypto.SHA256, hash[:], signature)
 	require.NoError(t, err, "Failed to verify signature")
 }
+
+func TestRSAVerifier_Verify(t *testing.T) {
+	t.Parallel()
+
+	generator := cryptic.NewRSAGenerator()
+	keyPair, err := generator.Generate()
+	require.NoError(t, err, "Failed to generate RSA key pair")
+
+	data := []byte("test data")
+	signature, err := cryptic.NewRSASigner(keyPair.Private, cryptic.SignatureOptions{}).Sign(data)
+	require.NoError(t, err, "Failed to sign data")
+
+	verifier := cryptic.NewRSAVerifier(keyPair.Public, cryptic.SignatureOptions{})
+
+	require.NoError(t, verifier.Verify(data, signature), "Failed to verify the signature")
+	require.ErrorIs(t, verifier.Verify([]byte("other data"), signature), cryptic.ErrInvalidSignature, "Tampered data should not verify")
+	require.ErrorIs(t, verifier.Verify(data, signature[1:]), cryptic.ErrInvalidSignature, "Tampered signature should not verify")
+}
+
+func TestUnmarshalRSAWithVerify(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := cryptic.GenerateRSAWithMarshal(cryptic.KeyParams{})
+	require.NoError(t, err, "Failed to generate and marshal RSA keys")
+
+	data := []byte("test data")
+	signature, err := cryptic.UnmarshalRSAWithSign(data, private, cryptic.SignatureOptions{})
+	require.NoError(t, err, "Failed to unmarshal and sign data")
+
+	require.NoError(t, cryptic.UnmarshalRSAWithVerify(data, signature, public, cryptic.SignatureOptions{}), "Failed to verify the signature")
+	err = cryptic.UnmarshalRSAWithVerify(data, signature, []byte("not a key"), cryptic.SignatureOptions{})
+	require.ErrorIs(t, err, cryptic.ErrInvalidPublicKey, "Malformed key should be rejected")
+}
@@ -0,0 +1,135 @@
+package cryptic
+
+// scheme.go implements the options selecting how data is signed: the signature scheme of RSA keys and the hash function.
+// RSA signs with PKCS#1 v1.5 or PSS, RSA and ECDSA hash with SHA-256, SHA-384 or SHA-512, Ed25519 signs the data itself.
+// Empty options select PKCS#1 v1.5 and SHA-256, which is how signatures were made before the options existed.
+// ECDSA signatures are encoded as ASN.1 DER by default or as fixed width IEEE P1363, the legacy encoding of unpadded r and s
+// is ambiguous and kept only for devices which signed with it before.
+
+import (
+	"crypto"
+	"fmt"
+	"slices"
+
+	// Hash functions are registered by their packages, crypto.Hash.New panics for the ones never imported.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const (
+	// SchemePKCS1v15 signs with RSASSA-PKCS1-v1_5.
+	SchemePKCS1v15 = "PKCS1v15"
+	// SchemePSS signs with RSASSA-PSS, the salt is as long as the hash.
+	SchemePSS = "PSS"
+
+	HashSHA256 = "SHA-256"
+	HashSHA384 = "SHA-384"
+	HashSHA512 = "SHA-512"
+
+	// EncodingDER encodes ECDSA signatures as ASN.1 DER sequence of r and s, as OpenSSL and most tools expect.
+	EncodingDER = "DER"
+	// EncodingP1363 encodes ECDSA signatures as r and s padded to the curve size, as JOSE and PKCS#11 tokens expect.
+	EncodingP1363 = "P1363"
+	// EncodingLegacy concatenates r and s without padding, the lengths are ambiguous and signatures can only be verified
+	// by trying every split.
+	EncodingLegacy = "legacy"
+)
+
+var (
+	// Schemes are the signature schemes of RSA keys.
+	Schemes = []string{SchemePKCS1v15, SchemePSS}
+	// Hashes are the hash functions data is hashed with before it is signed.
+	Hashes = []string{HashSHA256, HashSHA384, HashSHA512}
+	// Encodings are the encodings of ECDSA signatures.
+	Encodings = []string{EncodingDER, EncodingP1363, EncodingLegacy}
+)
+
+// SignatureOptions selects the signature scheme, the hash function and the encoding, zero values select the defaults of the algorithm.
+type SignatureOptions struct {
+	Scheme   string
+	Hash     string
+	Encoding string
+}
+
+// hash returns the hash function, SHA-256 when none is selected.
+func (o SignatureOptions) hash() (crypto.Hash, error) {
+	switch o.Hash {
+	case "", HashSHA256:
+		return crypto.SHA256, nil
+	case HashSHA384:
+		return crypto.SHA384, nil
+	case HashSHA512:
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("%w: hash can be one of %v", ErrInvalidSignatureOptions, Hashes)
+	}
+}
+
+// digest hashes the data with the hash function of the options.
+func (o SignatureOptions) digest(data []byte) (crypto.Hash, []byte, error) {
+	hash, err := o.hash()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	hasher := hash.New()
+	hasher.Write(data)
+
+	return hash, hasher.Sum(nil), nil
+}
+
+// RSAOptions checks options of RSA signatures and fills in PKCS#1 v1.5 and SHA-256 when none are selected.
+func RSAOptions(options SignatureOptions) (SignatureOptions, error) {
+	if options.Scheme == "" {
+		options.Scheme = SchemePKCS1v15
+	}
+
+	if !slices.Contains(Schemes, options.Scheme) {
+		return SignatureOptions{}, fmt.Errorf("%w: scheme can be one of %v", ErrInvalidSignatureOptions, Schemes)
+	}
+
+	if options.Encoding != "" {
+		return SignatureOptions{}, fmt.Errorf("%w: RSA has no encoding to choose", ErrInvalidSignatureOptions)
+	}
+
+	return withHash(options)
+}
+
+// ECDSAOptions checks options of ECDSA signatures and fills in SHA-256 and DER when none are selected, ECDSA has no schemes to choose.
+func ECDSAOptions(options SignatureOptions) (SignatureOptions, error) {
+	if options.Scheme != "" {
+		return SignatureOptions{}, fmt.Errorf("%w: ECDSA has no scheme to choose", ErrInvalidSignatureOptions)
+	}
+
+	if options.Encoding == "" {
+		options.Encoding = EncodingDER
+	}
+
+	if !slices.Contains(Encodings, options.Encoding) {
+		return SignatureOptions{}, fmt.Errorf("%w: encoding can be one of %v", ErrInvalidSignatureOptions, Encodings)
+	}
+
+	return withHash(options)
+}
+
+// Ed25519Options checks no options are selected, Ed25519 signs the data itself with its own scheme.
+func Ed25519Options(options SignatureOptions) (SignatureOptions, error) {
+	if options != (SignatureOptions{}) {
+		return SignatureOptions{}, fmt.Errorf("%w: Ed25519 has no scheme, hash or encoding to choose", ErrInvalidSignatureOptions)
+	}
+
+	return options, nil
+}
+
+// withHash checks the hash function of the options and fills in SHA-256 when none is selected.
+func withHash(options SignatureOptions) (SignatureOptions, error) {
+	if options.Hash == "" {
+		options.Hash = HashSHA256
+	}
+
+	if _, err := options.hash(); err != nil {
+		return SignatureOptions{}, err
+	}
+
+	return options, nil
+}
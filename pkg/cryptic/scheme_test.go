@@ -0,0 +1,159 @@
+package cryptic_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSAOptions(t *testing.T) {
+	t.Parallel()
+
+	generator := cryptic.NewRSAGenerator()
+	keyPair, err := generator.Generate()
+	require.NoError(t, err, "Failed to generate RSA key pair")
+
+	data := []byte("test data")
+
+	for _, scheme := range cryptic.Schemes {
+		for _, hash := range cryptic.Hashes {
+			options := cryptic.SignatureOptions{Scheme: scheme, Hash: hash}
+
+			signature, err := cryptic.NewRSASigner(keyPair.Private, options).Sign(data)
+			require.NoError(t, err, "Failed to sign with %s and %s", scheme, hash)
+
+			require.NoError(t, cryptic.NewRSAVerifier(keyPair.Public, options).Verify(data, signature), "%s with %s should verify", scheme, hash)
+
+			other := cryptic.SignatureOptions{Scheme: scheme, Hash: cryptic.HashSHA256}
+			if hash == cryptic.HashSHA256 {
+				other.Hash = cryptic.HashSHA512
+			}
+
+			require.ErrorIs(t, cryptic.NewRSAVerifier(keyPair.Public, other).Verify(data, signature), cryptic.ErrInvalidSignature, "Other hash should not verify")
+		}
+	}
+
+	// PSS signatures are checked by the standard library with the hash the options select.
+	options := cryptic.SignatureOptions{Scheme: cryptic.SchemePSS, Hash: cryptic.HashSHA512}
+	signature, err := cryptic.NewRSASigner(keyPair.Private, options).Sign(data)
+	require.NoError(t, err)
+
+	hashed := sha512.Sum512(data)
+	require.NoError(t, rsa.VerifyPSS(keyPair.Public, crypto.SHA512, hashed[:], signature, nil))
+	require.Error(t, rsa.VerifyPKCS1v15(keyPair.Public, crypto.SHA512, hashed[:], signature), "PSS signature is no PKCS#1 v1.5 signature")
+}
+
+func TestECDSAOptions(t *testing.T) {
+	t.Parallel()
+
+	generator := cryptic.NewECCGenerator()
+	keyPair, err := generator.Generate()
+	require.NoError(t, err, "Failed to generate ECDSA key pair")
+
+	data := []byte("test data")
+	options := cryptic.SignatureOptions{Hash: cryptic.HashSHA512}
+
+	signature, err := cryptic.NewECDSASigner(keyPair.Private, options).Sign(data)
+	require.NoError(t, err, "Failed to sign data")
+
+	hashed := sha512.Sum512(data)
+	assert.True(t, ecdsa.VerifyASN1(keyPair.Public, hashed[:], signature), "Signature should be made over the SHA-512 hash")
+
+	require.NoError(t, cryptic.NewECDSAVerifier(keyPair.Public, options).Verify(data, signature))
+	require.ErrorIs(t, cryptic.NewECDSAVerifier(keyPair.Public, cryptic.SignatureOptions{}).Verify(data, signature), cryptic.ErrInvalidSignature)
+}
+
+func TestECDSAEncodings(t *testing.T) {
+	t.Parallel()
+
+	generator := cryptic.ECCGenerator{Curve: elliptic.P521()}
+	keyPair, err := generator.Generate()
+	require.NoError(t, err, "Failed to generate ECDSA key pair")
+
+	data := []byte("test data")
+	hashed := sha256.Sum256(data)
+
+	for range 20 {
+		signature, err := cryptic.NewECDSASigner(keyPair.Private, cryptic.SignatureOptions{Encoding: cryptic.EncodingP1363}).Sign(data)
+		require.NoError(t, err)
+		require.Len(t, signature, 2*66, "P1363 signatures are padded to the curve size")
+
+		r, s := new(big.Int).SetBytes(signature[:66]), new(big.Int).SetBytes(signature[66:])
+		require.True(t, ecdsa.Verify(keyPair.Public, hashed[:], r, s))
+
+		der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		require.NoError(t, err)
+
+		legacy := append(r.Bytes(), s.Bytes()...)
+
+		for encoding, encoded := range map[string][]byte{cryptic.EncodingP1363: signature, cryptic.EncodingDER: der, cryptic.EncodingLegacy: legacy} {
+			verifier := cryptic.NewECDSAVerifier(keyPair.Public, cryptic.SignatureOptions{Encoding: encoding})
+			require.NoError(t, verifier.Verify(data, encoded), "%s signature should verify", encoding)
+		}
+
+		for encoding, encoded := range map[string][]byte{cryptic.EncodingP1363: der, cryptic.EncodingDER: signature} {
+			verifier := cryptic.NewECDSAVerifier(keyPair.Public, cryptic.SignatureOptions{Encoding: encoding})
+			require.ErrorIs(t, verifier.Verify(data, encoded), cryptic.ErrInvalidSignature, "%s should not accept other encodings", encoding)
+		}
+	}
+
+	signature, err := cryptic.NewECDSASigner(keyPair.Private, cryptic.SignatureOptions{Encoding: cryptic.EncodingLegacy}).Sign(data)
+	require.NoError(t, err)
+	require.NoError(t, cryptic.NewECDSAVerifier(keyPair.Public, cryptic.SignatureOptions{Encoding: cryptic.EncodingLegacy}).Verify(data, signature))
+}
+
+func TestSignatureOptions_Defaults(t *testing.T) {
+	t.Parallel()
+
+	options, err := cryptic.RSAOptions(cryptic.SignatureOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, cryptic.SignatureOptions{Scheme: cryptic.SchemePKCS1v15, Hash: cryptic.HashSHA256}, options)
+
+	options, err = cryptic.ECDSAOptions(cryptic.SignatureOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, cryptic.SignatureOptions{Hash: cryptic.HashSHA256, Encoding: cryptic.EncodingDER}, options)
+
+	options, err = cryptic.Ed25519Options(cryptic.SignatureOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, cryptic.SignatureOptions{}, options)
+}
+
+func TestSignatureOptions_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		check   func(cryptic.SignatureOptions) (cryptic.SignatureOptions, error)
+		options cryptic.SignatureOptions
+	}{
+		{"RSA unknown scheme", cryptic.RSAOptions, cryptic.SignatureOptions{Scheme: "OAEP"}},
+		{"RSA unknown hash", cryptic.RSAOptions, cryptic.SignatureOptions{Hash: "MD5"}},
+		{"ECDSA with scheme", cryptic.ECDSAOptions, cryptic.SignatureOptions{Scheme: cryptic.SchemePSS}},
+		{"ECDSA unknown encoding", cryptic.ECDSAOptions, cryptic.SignatureOptions{Encoding: "PEM"}},
+		{"RSA with encoding", cryptic.RSAOptions, cryptic.SignatureOptions{Encoding: cryptic.EncodingDER}},
+		{"Ed25519 with hash", cryptic.Ed25519Options, cryptic.SignatureOptions{Hash: cryptic.HashSHA512}},
+		{"Ed25519 with encoding", cryptic.Ed25519Options, cryptic.SignatureOptions{Encoding: cryptic.EncodingDER}},
+	}
+
+	for _, test := range tests {
+		_, err := test.check(test.options)
+		require.ErrorIs(t, err, cryptic.ErrInvalidSignatureOptions, test.name)
+	}
+
+	generator := cryptic.NewRSAGenerator()
+	keyPair, err := generator.Generate()
+	require.NoError(t, err)
+
+	_, err = cryptic.NewRSASigner(keyPair.Private, cryptic.SignatureOptions{Hash: "MD5"}).Sign([]byte("data"))
+	require.ErrorIs(t, err, cryptic.ErrInvalidSignatureOptions, "Signer should reject unknown hashes")
+}
@@ -9,3 +9,8 @@ var docs string
 
 //go:embed templates/elements.tpl
 var elements string
+
+// Spec returns the OpenAPI specification of the API, e.g. for validating requests against it.
+func Spec() []byte {
+	return []byte(docs)
+}
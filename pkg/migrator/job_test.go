@@ -0,0 +1,163 @@
+package migrator_test
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/migrator"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSchema creates an empty schema in the database given by POSTGRES_TEST_SOURCE and returns a source using it and a pool connected to it,
+// so migrations can be run from the start next to the storage tests. The test is skipped when the variable is not set.
+func newSchema(t *testing.T) (string, *pgxpool.Pool) {
+	t.Helper()
+
+	source := os.Getenv("POSTGRES_TEST_SOURCE")
+	if source == "" {
+		t.Skip("POSTGRES_TEST_SOURCE is not set")
+	}
+
+	ctx := context.Background()
+	schema := "migrator_" + uuid.New().String()[:8]
+
+	admin, err := pgxpool.New(ctx, source)
+	require.NoError(t, err)
+	t.Cleanup(admin.Close)
+
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_, err := admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		assert.NoError(t, err)
+	})
+
+	parsed, err := url.Parse(source)
+	require.NoError(t, err)
+
+	query := parsed.Query()
+	query.Set("search_path", schema)
+	parsed.RawQuery = query.Encode()
+
+	pool, err := pgxpool.New(ctx, parsed.String())
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	return parsed.String(), pool
+}
+
+// seedDevice inserts a device as it was stored at version 8, with keys retired as JSON and transactions with the counters.
+func seedDevice(t *testing.T, pool *pgxpool.Pool, algorithm, retiredKeys string, counters ...int64) uuid.UUID {
+	t.Helper()
+
+	ctx := context.Background()
+	key := uuid.New()
+
+	_, err := pool.Exec(ctx, `INSERT INTO devices (key, algorithm, public_key, key_handle, counter, retired_keys) VALUES ($1, $2, '', '', $3, $4)`,
+		key, algorithm, len(counters), retiredKeys)
+	require.NoError(t, err)
+
+	for _, counter := range counters {
+		_, err := pool.Exec(ctx, `INSERT INTO transactions (device_key, counter, signature, signed_data) VALUES ($1, $2, '', '')`, key, counter)
+		require.NoError(t, err)
+	}
+
+	return key
+}
+
+// signedWith returns the algorithm, scheme and hash recorded for the transaction.
+func signedWith(t *testing.T, pool *pgxpool.Pool, device uuid.UUID, counter int64) [3]string {
+	t.Helper()
+
+	var options [3]string
+
+	err := pool.QueryRow(context.Background(), `SELECT algorithm, scheme, hash FROM transactions WHERE device_key = $1 AND counter = $2`,
+		device, counter).Scan(&options[0], &options[1], &options[2])
+	require.NoError(t, err)
+
+	return options
+}
+
+func TestMigrate_SignatureOptions(t *testing.T) {
+	t.Parallel()
+
+	source, pool := newSchema(t)
+	require.NoError(t, migrator.Migrate(source, 8))
+
+	rotated := seedDevice(t, pool, "ECC", `[{"version":1,"algorithm":"RSA","from":0,"to":2},{"version":2,"algorithm":"ED25519","from":2,"to":2}]`, 0, 1, 2)
+	ed25519 := seedDevice(t, pool, "ED25519", `[]`, 0)
+
+	require.NoError(t, migrator.Migrate(source, 9))
+
+	tests := []struct {
+		name    string
+		device  uuid.UUID
+		counter int64
+		want    [3]string
+	}{
+		{"Retired RSA key", rotated, 0, [3]string{"RSA", "PKCS1v15", "SHA-256"}},
+		{"Last counter of retired key", rotated, 1, [3]string{"RSA", "PKCS1v15", "SHA-256"}},
+		{"Current ECDSA key", rotated, 2, [3]string{"ECC", "", "SHA-256"}},
+		{"Ed25519", ed25519, 0, [3]string{"ED25519", "", ""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, signedWith(t, pool, test.device, test.counter))
+		})
+	}
+}
+
+func TestMigrate_SignatureEncoding(t *testing.T) {
+	t.Parallel()
+
+	source, pool := newSchema(t)
+	require.NoError(t, migrator.Migrate(source, 8))
+
+	rotated := seedDevice(t, pool, "RSA", `[{"version":1,"algorithm":"ECC","from":0,"to":2}]`, 0, 1, 2)
+	ecdsa := seedDevice(t, pool, "ECC", `[]`, 0)
+
+	require.NoError(t, migrator.Migrate(source, 10))
+
+	tests := []struct {
+		name    string
+		device  uuid.UUID
+		counter int64
+		want    string
+	}{
+		{"Retired ECDSA key", rotated, 0, "legacy"},
+		{"Last counter of retired key", rotated, 1, "legacy"},
+		{"Current RSA key", rotated, 2, ""},
+		{"ECDSA", ecdsa, 0, "legacy"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var encoding string
+
+			err := pool.QueryRow(context.Background(), `SELECT encoding FROM transactions WHERE device_key = $1 AND counter = $2`,
+				test.device, test.counter).Scan(&encoding)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, encoding)
+		})
+	}
+
+	var current, retired string
+
+	err := pool.QueryRow(context.Background(), `SELECT d.encoding, d.retired_keys->0->>'encoding' FROM devices d WHERE d.key = $1`, rotated).
+		Scan(&current, &retired)
+	require.NoError(t, err)
+	assert.Equal(t, "", current)
+	assert.Equal(t, "legacy", retired)
+}
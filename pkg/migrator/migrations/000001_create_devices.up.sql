@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS devices (
+    key         UUID PRIMARY KEY,
+    algorithm   TEXT   NOT NULL,
+    label       TEXT   NOT NULL DEFAULT '',
+    public_key  BYTEA  NOT NULL,
+    private_key BYTEA  NOT NULL,
+    counter     BIGINT NOT NULL DEFAULT 0 CHECK (counter >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    device_key  UUID   NOT NULL REFERENCES devices (key) ON DELETE CASCADE,
+    counter     BIGINT NOT NULL CHECK (counter >= 0),
+    signature   BYTEA  NOT NULL,
+    signed_data BYTEA  NOT NULL,
+    PRIMARY KEY (device_key, counter)
+);
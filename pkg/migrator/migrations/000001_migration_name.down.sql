@@ -1 +0,0 @@
-# Put SQL needed for rollback migration here...
\ No newline at end of file
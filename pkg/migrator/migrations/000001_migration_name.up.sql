@@ -1 +0,0 @@
-# Put SQL needed for migration here...
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS devices_counter_idx;
+DROP INDEX IF EXISTS devices_label_idx;
+DROP INDEX IF EXISTS devices_created_at_idx;
+
+ALTER TABLE devices DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,5 @@
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS devices_created_at_idx ON devices (created_at, key);
+CREATE INDEX IF NOT EXISTS devices_label_idx ON devices ((label COLLATE "C"), key);
+CREATE INDEX IF NOT EXISTS devices_counter_idx ON devices (counter, key);
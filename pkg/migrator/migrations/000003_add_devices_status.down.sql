@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS status_changed_by;
+ALTER TABLE devices DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE devices DROP COLUMN IF EXISTS status;
@@ -0,0 +1,5 @@
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS status_changed_by TEXT NOT NULL DEFAULT '';
+
+UPDATE devices SET status_changed_at = created_at;
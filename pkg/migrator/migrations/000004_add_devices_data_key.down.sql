@@ -0,0 +1,3 @@
+-- Private keys sealed in the meantime stay encrypted, they can be recovered only with the master keys.
+ALTER TABLE devices DROP COLUMN IF EXISTS master_key_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS data_key;
@@ -0,0 +1,3 @@
+-- Private keys become ciphertext, existing plaintext keys have an empty master key ID and are sealed by the next master key rotation.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS data_key BYTEA NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS master_key_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE devices RENAME COLUMN key_handle TO private_key;
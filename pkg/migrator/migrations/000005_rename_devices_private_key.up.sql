@@ -0,0 +1,2 @@
+-- Devices reference private keys in a keystore, for the software keystore the handle is still the private key.
+ALTER TABLE devices RENAME COLUMN private_key TO key_handle;
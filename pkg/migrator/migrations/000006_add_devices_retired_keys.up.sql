@@ -0,0 +1,2 @@
+-- Retired public keys with the counter ranges they signed, ordered by version.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS retired_keys JSONB NOT NULL DEFAULT '[]';
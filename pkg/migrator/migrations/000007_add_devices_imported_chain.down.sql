@@ -0,0 +1,2 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS imported_signature;
+ALTER TABLE devices DROP COLUMN IF EXISTS imported_counter;
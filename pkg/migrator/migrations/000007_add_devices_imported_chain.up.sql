@@ -0,0 +1,3 @@
+-- Devices migrated from another system continue its signature chain from the imported counter and last signature.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS imported_counter BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS imported_signature TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS curve;
+ALTER TABLE devices DROP COLUMN IF EXISTS bits;
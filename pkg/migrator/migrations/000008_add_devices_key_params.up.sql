@@ -0,0 +1,3 @@
+-- Modulus size of RSA keys and curve of ECDSA keys, empty for devices created before they were recorded.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS bits INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS curve TEXT NOT NULL DEFAULT '';
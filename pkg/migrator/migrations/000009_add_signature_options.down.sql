@@ -0,0 +1,5 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS hash;
+ALTER TABLE transactions DROP COLUMN IF EXISTS scheme;
+ALTER TABLE transactions DROP COLUMN IF EXISTS algorithm;
+ALTER TABLE devices DROP COLUMN IF EXISTS hash;
+ALTER TABLE devices DROP COLUMN IF EXISTS scheme;
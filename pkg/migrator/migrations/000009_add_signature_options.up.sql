@@ -0,0 +1,18 @@
+-- Signature scheme and hash of the device key, empty for devices created before they were recorded which sign with the defaults.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS scheme TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS hash TEXT NOT NULL DEFAULT '';
+-- How each transaction was signed.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS algorithm TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS scheme TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS hash TEXT NOT NULL DEFAULT '';
+
+-- Transactions signed before were signed with the defaults by the key covering their counter, a retired key of the device
+-- or its current key: RSA with PKCS#1 v1.5 and SHA-256, ECDSA with SHA-256 and Ed25519 with neither.
+UPDATE transactions t SET algorithm = COALESCE((
+    SELECT retired->>'algorithm'
+    FROM jsonb_array_elements(d.retired_keys) AS keys (retired)
+    WHERE t.counter >= (retired->>'from')::BIGINT AND t.counter < (retired->>'to')::BIGINT
+), d.algorithm)
+FROM devices d WHERE t.device_key = d.key AND t.algorithm = '';
+UPDATE transactions SET scheme = 'PKCS1v15' WHERE algorithm = 'RSA' AND scheme = '';
+UPDATE transactions SET hash = 'SHA-256' WHERE algorithm IN ('RSA', 'ECC') AND hash = '';
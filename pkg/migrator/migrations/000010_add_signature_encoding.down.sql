@@ -0,0 +1,6 @@
+UPDATE devices SET retired_keys = (
+    SELECT jsonb_agg(retired - 'encoding' ORDER BY ordinal)
+    FROM jsonb_array_elements(retired_keys) WITH ORDINALITY AS keys (retired, ordinal)
+) WHERE jsonb_array_length(retired_keys) > 0;
+ALTER TABLE transactions DROP COLUMN IF EXISTS encoding;
+ALTER TABLE devices DROP COLUMN IF EXISTS encoding;
@@ -0,0 +1,16 @@
+-- Encoding of ECDSA signatures, DER for new devices. Every ECDSA signature made before was encoded the legacy way,
+-- so existing ECDSA devices, their retired keys and their recorded transactions keep verifying with it.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS encoding TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS encoding TEXT NOT NULL DEFAULT '';
+
+UPDATE devices SET encoding = 'legacy' WHERE algorithm = 'ECC' AND encoding = '';
+UPDATE devices SET retired_keys = (
+    SELECT jsonb_agg(CASE WHEN retired->>'algorithm' = 'ECC' AND NOT retired ? 'encoding' THEN retired || '{"encoding": "legacy"}' ELSE retired END ORDER BY ordinal)
+    FROM jsonb_array_elements(retired_keys) WITH ORDINALITY AS keys (retired, ordinal)
+) WHERE jsonb_array_length(retired_keys) > 0;
+-- Transactions are matched to the key covering their counter rather than by their algorithm, which is only recorded since 000009.
+UPDATE transactions t SET encoding = 'legacy' FROM devices d WHERE t.device_key = d.key AND t.encoding = '' AND COALESCE((
+    SELECT retired->>'algorithm'
+    FROM jsonb_array_elements(d.retired_keys) AS keys (retired)
+    WHERE t.counter >= (retired->>'from')::BIGINT AND t.counter < (retired->>'to')::BIGINT
+), d.algorithm) = 'ECC';
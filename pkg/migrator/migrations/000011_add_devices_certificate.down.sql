@@ -0,0 +1,5 @@
+UPDATE devices SET retired_keys = (
+    SELECT jsonb_agg(retired - 'certificate' ORDER BY ordinal)
+    FROM jsonb_array_elements(retired_keys) WITH ORDINALITY AS keys (retired, ordinal)
+) WHERE jsonb_array_length(retired_keys) > 0;
+ALTER TABLE devices DROP COLUMN IF EXISTS certificate;
@@ -0,0 +1,3 @@
+-- PEM encoded X.509 certificate of the current device key, devices created before certificates were issued have none.
+-- Certificates of retired keys are kept with them in retired_keys.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS certificate BYTEA NOT NULL DEFAULT '';
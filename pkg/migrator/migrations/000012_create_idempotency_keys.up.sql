@@ -0,0 +1,13 @@
+-- Idempotency keys of signing requests, global and stored in the same database transaction as the transaction signed for them.
+-- The device and the fingerprint, the SHA-256 hash of the signed data, are recorded with the key, retries with another device
+-- or other data conflict. Expired keys are purged when their device signs or the key is used again.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key         TEXT        PRIMARY KEY,
+    device_key  UUID        NOT NULL,
+    fingerprint BYTEA       NOT NULL,
+    counter     BIGINT      NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (device_key, counter) REFERENCES transactions (device_key, counter) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (device_key, expires_at);
@@ -0,0 +1,171 @@
+package signature
+
+// audit.go implements the audit of the signature chain of a device and the HTTP handler serving it.
+// The audit walks the transactions in counter order and checks that counters are contiguous, that every signed data starts with
+// its counter and references the previous signature, and that every signature verifies with the device key valid for its counter.
+// It stops at the first break, which is reported as the result of the audit and not as an error of the request.
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditReport represents the result of auditing the signature chain of a device up to its counter at the time of the audit.
+// Checked transactions start at From, which is zero unless the device continued the chain of another system.
+// LastSignature is the signature of the last intact transaction, attestations can pin the chain to it.
+type AuditReport struct {
+	DeviceKey     uuid.UUID   `json:"deviceKey"`
+	Valid         bool        `json:"valid"`
+	From          int64       `json:"from"`
+	Counter       int64       `json:"counter"`
+	Checked       int64       `json:"checked"`
+	LastSignature string      `json:"lastSignature,omitempty"`
+	Break         *ChainBreak `json:"break,omitempty"`
+	AuditedAt     time.Time   `json:"auditedAt"`
+}
+
+// ChainBreak represents the first transaction which breaks the signature chain and the reason.
+type ChainBreak struct {
+	Counter int64  `json:"counter"`
+	Reason  string `json:"reason"`
+}
+
+// ChainAudit checks transactions of a device one by one in counter order, starting at the counter the device was created or imported with.
+// Once the chain is broken every further check fails with the same error.
+type ChainAudit struct {
+	device   Device
+	next     int64
+	previous string
+	err      error
+}
+
+// NewChainAudit starts the audit of the device chain, the first signed data references the base64 encoded device key
+// or the last signature of the system an imported device came from.
+func NewChainAudit(device Device) *ChainAudit {
+	previous := base64.StdEncoding.EncodeToString([]byte(device.Key.String()))
+	if device.ImportedCounter > 0 {
+		previous = device.ImportedSignature
+	}
+
+	return &ChainAudit{device: device, next: device.ImportedCounter, previous: previous}
+}
+
+// Check checks the next transaction of the chain.
+func (a *ChainAudit) Check(transaction Transaction) error {
+	if a.err != nil {
+		return a.err
+	}
+
+	a.err = a.check(transaction)
+	if a.err != nil {
+		return a.err
+	}
+
+	a.next++
+	a.previous = transaction.Signature
+
+	return nil
+}
+
+// check checks the transaction against the expected counter and previous signature.
+func (a *ChainAudit) check(transaction Transaction) error {
+	if transaction.Counter != a.next {
+		return fmt.Errorf("%w, transaction %d is missing", ErrChainBroken, a.next)
+	}
+
+	prefix, _, _ := strings.Cut(transaction.SignedData, "_")
+	if prefix != strconv.FormatInt(transaction.Counter, 10) {
+		return fmt.Errorf("%w, signed data does not start with counter %d", ErrChainBroken, transaction.Counter)
+	}
+
+	if !strings.HasSuffix(transaction.SignedData, "_"+a.previous) {
+		return fmt.Errorf("%w, signed data does not reference the previous signature", ErrChainBroken)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(transaction.Signature)
+	if err != nil {
+		return fmt.Errorf("%w, %w", ErrChainBroken, ErrSignatureNotBase64)
+	}
+
+	if err := verifySignature(a.device, []byte(transaction.SignedData), signature); err != nil {
+		return fmt.Errorf("%w, %w", ErrChainBroken, err)
+	}
+
+	return nil
+}
+
+// Report finishes the audit, the chain is only valid when it was intact and reached the device counter.
+func (a *ChainAudit) Report() AuditReport {
+	report := AuditReport{
+		DeviceKey: a.device.Key,
+		Valid:     true,
+		From:      a.device.ImportedCounter,
+		Counter:   a.device.Counter,
+		Checked:   a.next - a.device.ImportedCounter,
+		AuditedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	if report.Checked > 0 {
+		report.LastSignature = a.previous
+	}
+
+	err := a.err
+	if err == nil && a.next < a.device.Counter {
+		err = fmt.Errorf("%w, transaction %d is missing", ErrChainBroken, a.next)
+	}
+
+	if err != nil {
+		report.Valid = false
+		report.Break = &ChainBreak{Counter: a.next, Reason: err.Error()}
+	}
+
+	return report
+}
+
+// Audit serves the audit of the signature chain of the device up to its current counter.
+// Transactions signed while the audit runs are left for the next one.
+func (h *Handler) Audit(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	device, err := h.storage.FindDevice(r.Context(), key)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	audit := NewChainAudit(device)
+	input := ListTransactionsInput{DeviceKey: device.Key, From: device.ImportedCounter, Limit: MaxLimit}
+
+pages:
+	for input.From < device.Counter {
+		transactions, err := h.storage.ListTransactions(r.Context(), input)
+		if err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+
+		for _, transaction := range transactions {
+			if transaction.Counter >= device.Counter || audit.Check(transaction) != nil {
+				break pages
+			}
+		}
+
+		if len(transactions) < input.Limit {
+			break
+		}
+
+		input.From = transactions[len(transactions)-1].Counter + 1
+	}
+
+	writeJSON(w, r, http.StatusOK, audit.Report())
+}
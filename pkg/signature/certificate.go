@@ -0,0 +1,225 @@
+package signature
+
+// certificate.go implements X.509 certificates of device keys issued by the certificate authority of the service and the HTTP handlers serving them.
+// Every key of a device gets its own certificate when the device is created or its key rotated, the subject names the device by its key and label.
+// Certificates are revoked as superseded when their key is retired and as ceased when the device is decommissioned, the revocation list is
+// derived from the devices on every request, so it always matches their history. Suspended devices keep valid certificates.
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+)
+
+// Media types certificates and revocation lists are served as.
+const (
+	MediaTypePEMChain    = "application/pem-certificate-chain"
+	MediaTypeCertificate = "application/pkix-cert"
+	MediaTypeCRL         = "application/pkix-crl"
+)
+
+// oidDescription is the X.520 description attribute, the subject carries the device label in it.
+var oidDescription = asn1.ObjectIdentifier{2, 5, 4, 13}
+
+// deviceSubject names the device by its key as common name and its label as description, which allows for 1024 characters.
+func deviceSubject(device Device) pkix.Name {
+	subject := pkix.Name{CommonName: device.Key.String()}
+
+	if device.Label != "" {
+		subject.ExtraNames = []pkix.AttributeTypeAndValue{{Type: oidDescription, Value: string(device.Label)}}
+	}
+
+	return subject
+}
+
+// issueCertificate issues the PEM encoded certificate of the current device key, valid from notBefore.
+func issueCertificate(authority *cryptic.CertificateAuthority, device Device, notBefore time.Time) ([]byte, error) {
+	public, err := cryptic.ParsePublicKey(device.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return authority.Issue(deviceSubject(device), public, notBefore)
+}
+
+// parseCertificate decodes the PEM encoded certificate of a device key.
+func parseCertificate(certificate []byte) (*x509.Certificate, error) {
+	certificates, err := cryptic.ParseCertificates(certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return certificates[0], nil
+}
+
+// VerifyCertificates checks that every key of the device has a certificate for it issued by one of the roots, intermediates may be among them.
+// Chains are checked at the time each certificate was issued, revocation is up to the revocation list.
+func VerifyCertificates(device Device, roots *x509.CertPool) error {
+	for _, key := range append(append([]DeviceKey{}, device.RetiredKeys...), device.CurrentKey()) {
+		if len(key.Certificate) == 0 {
+			return fmt.Errorf("%w, key version %d", ErrCertificateNotFound, key.Version)
+		}
+
+		certificate, err := parseCertificate(key.Certificate)
+		if err != nil {
+			return err
+		}
+
+		public, err := cryptic.ParsePublicKey(key.PublicKey)
+		if err != nil {
+			return err
+		}
+
+		if certified, ok := certificate.PublicKey.(interface{ Equal(x crypto.PublicKey) bool }); !ok || !certified.Equal(public) {
+			return fmt.Errorf("%w, certificate of key version %d is for another key", cryptic.ErrInvalidCertificate, key.Version)
+		}
+
+		options := x509.VerifyOptions{Roots: roots, CurrentTime: certificate.NotBefore, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+		if _, err := certificate.Verify(options); err != nil {
+			return fmt.Errorf("%w, key version %d: %w", cryptic.ErrInvalidCertificate, key.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// revokedCertificates lists the revoked certificates of the device: those of retired keys and the current one of a decommissioned device.
+// Keys of devices created before certificates were issued have none to revoke.
+func revokedCertificates(device Device) ([]x509.RevocationListEntry, error) {
+	var revoked []x509.RevocationListEntry
+
+	revoke := func(certificate []byte, at time.Time, reason int) error {
+		if len(certificate) == 0 {
+			return nil
+		}
+
+		parsed, err := parseCertificate(certificate)
+		if err != nil {
+			return err
+		}
+
+		revoked = append(revoked, x509.RevocationListEntry{SerialNumber: parsed.SerialNumber, RevocationTime: at, ReasonCode: reason})
+
+		return nil
+	}
+
+	for _, key := range device.RetiredKeys {
+		if err := revoke(key.Certificate, key.RotatedAt, cryptic.ReasonSuperseded); err != nil {
+			return nil, err
+		}
+	}
+
+	if device.Status == StatusDecommissioned {
+		if err := revoke(device.Certificate, device.StatusChangedAt, cryptic.ReasonCessationOfOperation); err != nil {
+			return nil, err
+		}
+	}
+
+	return revoked, nil
+}
+
+// CertificateAuthority serves the PEM encoded certificate chain of the CA issuing device certificates, CA certificate first.
+func (h *Handler) CertificateAuthority(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", MediaTypePEMChain)
+	_, _ = w.Write(h.authority.ChainPEM())
+}
+
+// DeviceCertificate serves the certificate of the current device key, as PEM chain followed by the CA chain or as DER by the Accept header.
+func (h *Handler) DeviceCertificate(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+
+	mediaType, acceptable := negotiateCertificate(r.Header.Get("Accept"))
+	if !acceptable {
+		writeProblem(w, r, fmt.Errorf("%w, expected one of: %s, %s", ErrNotAcceptable, MediaTypePEMChain, MediaTypeCertificate))
+		return
+	}
+
+	device, err := h.storage.FindDevice(r.Context(), key)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	if len(device.Certificate) == 0 {
+		writeProblem(w, r, ErrCertificateNotFound)
+		return
+	}
+
+	body := append(append([]byte{}, device.Certificate...), h.authority.ChainPEM()...)
+
+	if mediaType == MediaTypeCertificate {
+		certificate, err := parseCertificate(device.Certificate)
+		if err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+
+		body = certificate.Raw
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	_, _ = w.Write(body)
+}
+
+// RevocationList serves the DER encoded CRL of all revoked device certificates, signed by the CA on every request.
+// The CRL number is the time it is issued at in microseconds, so every list has a greater number than the ones before.
+func (h *Handler) RevocationList(w http.ResponseWriter, r *http.Request) {
+	var revoked []x509.RevocationListEntry
+
+	err := h.eachDevice(r, ListDevicesInput{}, func(device Device) error {
+		entries, err := revokedCertificates(device)
+		revoked = append(revoked, entries...)
+
+		return err
+	})
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC()
+
+	crl, err := h.authority.RevocationList(revoked, big.NewInt(now.UnixMicro()), now)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", MediaTypeCRL)
+	_, _ = w.Write(crl)
+}
+
+// negotiateCertificate returns the first media type of the Accept header a certificate can be served as, quality values are not weighed.
+// Without an Accept header the certificate is served as PEM chain.
+func negotiateCertificate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return MediaTypePEMChain, true
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case MediaTypePEMChain, MediaTypePEM, "application/*", "*/*":
+			return MediaTypePEMChain, true
+		case MediaTypeCertificate:
+			return MediaTypeCertificate, true
+		}
+	}
+
+	return "", false
+}
@@ -1,15 +1,40 @@
 package signature
 
 // errors.go defines common error messages used across the `signature` package.
-// Errors are used for handling invalid algorithms, missing devices, existing devices, missing transactions, and empty request bodies.
+// Errors are used for handling invalid algorithms, missing devices, existing devices, inactive devices, missing transactions, master keys, empty request bodies,
+// media types which cannot be served, devices without certificates, broken signature chains, malformed chain exports,
+// idempotency keys which are malformed or reused with other data, batches of the wrong size and request bodies which are not valid JSON or too large.
 
 import "errors"
 
 var (
-	ErrInvalidAlgorithm    = errors.New(`algorithm can be "RSA" or "ECC"`)
-	ErrLabelTooLong        = errors.New("label cannot have more than 255 characters")
-	ErrDataIncorrectSize   = errors.New("data characters has to be between 2 and 1024")
-	ErrDeviceNotFound      = errors.New("device not found")
-	ErrDeviceAlreadyExists = errors.New("device already exists")
-	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrInvalidAlgorithm       = errors.New("algorithm is not supported")
+	ErrLabelTooLong           = errors.New("label cannot have more than 255 characters")
+	ErrDataIncorrectSize      = errors.New("data characters has to be between 2 and 1024")
+	ErrDeviceNotFound         = errors.New("device not found")
+	ErrDeviceAlreadyExists    = errors.New("device already exists")
+	ErrDeviceNotActive        = errors.New("device is not active")
+	ErrDeviceDecommissioned   = errors.New("device is decommissioned")
+	ErrInvalidTransition      = errors.New("device status cannot be changed")
+	ErrInvalidActor           = errors.New("changedBy has to have between 1 and 255 characters")
+	ErrTransactionNotFound    = errors.New("transaction not found")
+	ErrSignatureNotBase64     = errors.New("signature has to be base64 encoded")
+	ErrInvalidCursor          = errors.New("cursor is not valid")
+	ErrInvalidLimit           = errors.New("limit has to be between 1 and 1000")
+	ErrInvalidSort            = errors.New(`sort can be "createdAt", "label" or "counter"`)
+	ErrInvalidOrder           = errors.New(`order can be "asc" or "desc"`)
+	ErrInvalidStatus          = errors.New(`status can be "active", "suspended" or "decommissioned"`)
+	ErrNotAcceptable          = errors.New("none of the accepted media types can be served")
+	ErrCertificateNotFound    = errors.New("device has no certificate, rotate its key to issue one")
+	ErrChainBroken            = errors.New("signature chain is broken")
+	ErrInvalidExport          = errors.New("chain export is not valid")
+	ErrInvalidIdempotencyKey  = errors.New("Idempotency-Key has to have between 1 and 255 printable characters")
+	ErrIdempotencyKeyConflict = errors.New("Idempotency-Key was already used with another device or other data")
+	ErrInvalidBatchSize       = errors.New("batch has to have between 1 and 100 data items")
+	ErrMalformedBody          = errors.New("request body is not valid JSON")
+	ErrBodyTooLarge           = errors.New("request body is too large")
+	ErrInvalidMasterKey       = errors.New("master key is not valid")
+	ErrKeyImportConflict      = errors.New("privateKey and keyHandle cannot be combined")
+	ErrInvalidChain           = errors.New("counter cannot be negative and a positive counter requires lastSignature")
+	ErrMasterKeyNotFound      = errors.New("master key not found")
 )
@@ -0,0 +1,206 @@
+package signature
+
+// export.go implements exports of device signature chains, which are audited offline without access to the service.
+// An export holds the public part of the device, with its retired keys and certificates, followed by its transactions in counter order.
+// The service exports JSON lines, the device on the first line and one transaction per line after it, so exports of any length stream.
+// Exports are read back either as JSON lines or as a single ChainExport document.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// MediaTypeJSONL is the media type of chains exported as JSON lines.
+const MediaTypeJSONL = "application/jsonl"
+
+// ChainExport represents an exported chain as a single document.
+type ChainExport struct {
+	Device       DeviceResponse `json:"device"`
+	Transactions []Transaction  `json:"transactions"`
+}
+
+// NewPublicDevice rebuilds the public part of a device from its response, which is all it takes to verify and audit its chain.
+func NewPublicDevice(response DeviceResponse) Device {
+	device := Device{
+		Key:               response.Key,
+		Algorithm:         response.Algorithm,
+		Bits:              response.Bits,
+		Curve:             response.Curve,
+		Scheme:            response.Scheme,
+		Hash:              response.Hash,
+		Encoding:          response.Encoding,
+		PublicKey:         []byte(response.PublicKey),
+		Certificate:       []byte(response.Certificate),
+		Label:             response.Label,
+		Counter:           response.Counter,
+		CreatedAt:         response.CreatedAt,
+		Status:            response.Status,
+		StatusChangedAt:   response.StatusChangedAt,
+		StatusChangedBy:   response.StatusChangedBy,
+		ImportedCounter:   response.ImportedCounter,
+		ImportedSignature: response.ImportedSignature,
+	}
+
+	for _, key := range response.RetiredKeys {
+		retired := DeviceKey{
+			Version:     key.Version,
+			Algorithm:   key.Algorithm,
+			Bits:        key.Bits,
+			Curve:       key.Curve,
+			Scheme:      key.Scheme,
+			Hash:        key.Hash,
+			Encoding:    key.Encoding,
+			PublicKey:   []byte(key.PublicKey),
+			Certificate: []byte(key.Certificate),
+			From:        key.From,
+			To:          key.To,
+			RotatedAt:   key.RotatedAt,
+		}
+
+		// Keys without certificates are kept without, just like storages return them.
+		if len(retired.Certificate) == 0 {
+			retired.Certificate = nil
+		}
+
+		device.RetiredKeys = append(device.RetiredKeys, retired)
+	}
+
+	if len(device.Certificate) == 0 {
+		device.Certificate = nil
+	}
+
+	return device
+}
+
+// AuditExport reads an exported chain and audits it the same way the service audits chains, it returns the device of the export with the report.
+// JSON lines are audited while they are read, so they are never held in memory. Malformed exports are errors, broken chains are reported.
+func AuditExport(r io.Reader) (Device, AuditReport, error) {
+	decoder := json.NewDecoder(r)
+
+	var first json.RawMessage
+	if err := decoder.Decode(&first); err != nil {
+		return Device{}, AuditReport{}, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+	}
+
+	var document struct {
+		Device       *DeviceResponse `json:"device"`
+		Transactions []Transaction   `json:"transactions"`
+	}
+
+	if err := json.Unmarshal(first, &document); err != nil {
+		return Device{}, AuditReport{}, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+	}
+
+	if document.Device != nil {
+		device := NewPublicDevice(*document.Device)
+		audit := NewChainAudit(device)
+
+		for _, transaction := range document.Transactions {
+			if transaction.Counter >= device.Counter || audit.Check(transaction) != nil {
+				break
+			}
+		}
+
+		return device, audit.Report(), nil
+	}
+
+	var response DeviceResponse
+	if err := json.Unmarshal(first, &response); err != nil || response.Key == uuid.Nil {
+		return Device{}, AuditReport{}, fmt.Errorf("%w: the first line has to be the device", ErrInvalidExport)
+	}
+
+	device := NewPublicDevice(response)
+	audit := NewChainAudit(device)
+
+	for {
+		var transaction Transaction
+
+		err := decoder.Decode(&transaction)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return Device{}, AuditReport{}, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+		}
+
+		if transaction.Counter >= device.Counter || audit.Check(transaction) != nil {
+			break
+		}
+	}
+
+	return device, audit.Report(), nil
+}
+
+// ExportChain serves the chain of the device as JSON lines, the device on the first line followed by its transactions up to its counter.
+// Transactions signed while the export runs are left for the next one.
+func (h *Handler) ExportChain(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	device, err := h.storage.FindDevice(r.Context(), key)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	// The device line is buffered with the first page, so failures before anything is written are still reported.
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+	if err := encoder.Encode(NewDeviceResponse(device)); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	input := ListTransactionsInput{DeviceKey: device.Key, From: device.ImportedCounter, Limit: MaxLimit}
+	written := false
+
+	for input.From < device.Counter {
+		transactions, err := h.storage.ListTransactions(r.Context(), input)
+		if err != nil && !written {
+			writeProblem(w, r, err)
+			return
+		}
+
+		// Once streaming has started the status is sent, a truncated export fails the audit instead.
+		if err != nil {
+			return
+		}
+
+		for _, transaction := range transactions {
+			if transaction.Counter < device.Counter {
+				_ = encoder.Encode(transaction)
+			}
+		}
+
+		if !written {
+			w.Header().Set("Content-Type", MediaTypeJSONL)
+			written = true
+		}
+
+		if _, err := buffer.WriteTo(w); err != nil {
+			return
+		}
+
+		if len(transactions) < input.Limit {
+			break
+		}
+
+		input.From = transactions[len(transactions)-1].Counter + 1
+	}
+
+	if !written {
+		w.Header().Set("Content-Type", MediaTypeJSONL)
+		_, _ = buffer.WriteTo(w)
+	}
+}
@@ -0,0 +1,109 @@
+package signature_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature/storagetest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "regenerate signed data and signatures of golden vectors in testdata")
+
+// vector is a frozen reference signature chain of a device with fixed keys.
+// Deterministic algorithms must reproduce the exact signatures, for the others every recorded signature has to verify.
+// Encoding is the encoding of ECDSA signatures, the legacy vector freezes signatures of devices created before encodings existed.
+type vector struct {
+	Algorithm     signature.Algorithm `json:"algorithm"`
+	Deterministic bool                `json:"deterministic"`
+	Encoding      string              `json:"encoding,omitempty"`
+	DeviceKey     uuid.UUID           `json:"deviceKey"`
+	PublicKey     string              `json:"publicKey"`
+	PrivateKey    string              `json:"privateKey"`
+	Transactions  []struct {
+		Data       signature.Data `json:"data"`
+		SignedData string         `json:"signedData"`
+		Signature  string         `json:"signature"`
+	} `json:"transactions"`
+}
+
+func TestGoldenVectors(t *testing.T) {
+	t.Parallel()
+
+	files, err := filepath.Glob(filepath.Join("testdata", "golden_*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			t.Parallel()
+
+			content, err := os.ReadFile(file)
+			require.NoError(t, err)
+
+			var vector vector
+			require.NoError(t, json.Unmarshal(content, &vector))
+
+			algorithm, err := cryptic.Lookup(string(vector.Algorithm))
+			require.NoError(t, err)
+
+			keyring := storagetest.NewKeyring(t, "first")
+			store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), keyring, cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+			chain := []signature.Transaction{}
+
+			for i, expected := range vector.Transactions {
+				// The device is restored to the frozen state before every signature, so chains of randomized algorithms can be checked too.
+				device, err := keyring.Seal(signature.Device{
+					Key:       vector.DeviceKey,
+					Algorithm: vector.Algorithm,
+					Encoding:  vector.Encoding,
+					PublicKey: []byte(vector.PublicKey),
+					KeyHandle: []byte(vector.PrivateKey),
+					Counter:   int64(i),
+					Status:    signature.StatusActive,
+				})
+				require.NoError(t, err)
+
+				store.Devices[vector.DeviceKey] = device
+				store.Transactions[vector.DeviceKey] = chain
+
+				transaction, err := store.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: vector.DeviceKey, Data: expected.Data})
+				require.NoError(t, err)
+
+				if *update {
+					vector.Transactions[i].SignedData = transaction.SignedData
+					vector.Transactions[i].Signature = transaction.Signature
+					expected = vector.Transactions[i]
+				}
+
+				assert.Equal(t, expected.SignedData, transaction.SignedData, "transaction %d signed data", i)
+
+				if vector.Deterministic {
+					assert.Equal(t, expected.Signature, transaction.Signature, "transaction %d signature", i)
+				}
+
+				signed, err := base64.StdEncoding.DecodeString(expected.Signature)
+				require.NoError(t, err)
+				options := cryptic.SignatureOptions{Encoding: vector.Encoding}
+				require.NoError(t, algorithm.Verify([]byte(expected.SignedData), signed, []byte(vector.PublicKey), options), "transaction %d signature", i)
+
+				chain = append(chain, signature.Transaction{Counter: int64(i), Signature: expected.Signature, SignedData: expected.SignedData})
+			}
+
+			if *update {
+				content, err := json.MarshalIndent(vector, "", "  ")
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(file, append(content, '\n'), 0o600))
+			}
+		})
+	}
+}
@@ -1,44 +1,85 @@
 package signature
 
 // handler.go implements the HTTP handlers for managing signature devices and transactions.
-// It provides endpoints for listing devices, finding devices by UUID, creating new devices, and creating transactions.
+// It provides endpoints for listing devices, finding devices by UUID, creating new devices, changing their lifecycle state,
+// rotating their keys, creating single transactions and batches of them, listing and finding transactions and verifying signatures.
+// Public keys are exported by publickey.go, certificates and revocation lists are served by certificate.go, signature chains are audited
+// by audit.go and exported by export.go.
 // These handlers interact with the underlying storage through the defined `Storage` interface, and responses in JSON format.
+// Devices are always returned as `DeviceResponse`, so private keys never leave the service.
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
 	"github.com/google/uuid"
 )
 
 // Storage defines an interface for device and transaction operations.
 type Storage interface {
-	ListDevices(ctx context.Context) ([]Device, error)
+	ListDevices(ctx context.Context, input ListDevicesInput) ([]Device, error)
 	FindDevice(ctx context.Context, key uuid.UUID) (Device, error)
 	CreateDevice(ctx context.Context, input CreateDeviceInput) (Device, error)
+	ChangeDeviceStatus(ctx context.Context, input ChangeDeviceStatusInput) (Device, error)
+	RotateDeviceKey(ctx context.Context, input RotateDeviceKeyInput) (Device, error)
 	CreateTransaction(ctx context.Context, input CreateTransactionInput) (Transaction, error)
+	CreateTransactions(ctx context.Context, input CreateTransactionsInput) ([]Transaction, error)
+	ListTransactions(ctx context.Context, input ListTransactionsInput) ([]Transaction, error)
+	FindTransaction(ctx context.Context, deviceKey uuid.UUID, counter int64) (Transaction, error)
+	RotateMasterKey(ctx context.Context, keyring *Keyring) (int, error)
 }
 
-// NewHandler creates a new HTTP handler with routing.
-func NewHandler(s Storage) *Handler {
+const (
+	// DefaultLimit is the page size of devices and transactions when the client does not ask for any.
+	DefaultLimit = 100
+	// MaxLimit is the largest page size of devices and transactions a client can ask for.
+	MaxLimit = 1000
+	// MaxBatchSize is the largest number of data items signed in one batch.
+	MaxBatchSize = 100
+)
+
+// NewHandler creates a new HTTP handler with routing, the certificate authority has to be the one the storage issues certificates with.
+// Idempotency keys of signing requests are kept for the idempotency window.
+func NewHandler(s Storage, authority *cryptic.CertificateAuthority, idempotencyWindow time.Duration) *Handler {
 	router := http.NewServeMux()
 
-	handler := &Handler{router: router, storage: s}
+	handler := &Handler{router: router, storage: s, authority: authority, idempotencyWindow: idempotencyWindow}
 
 	handler.router.HandleFunc("GET /device", handler.ListDevices)
 	handler.router.HandleFunc("GET /device/{key}", handler.FindDevice)
+	handler.router.HandleFunc("GET /device/{key}/public-key", handler.PublicKey)
+	handler.router.HandleFunc("GET /device/{key}/certificate", handler.DeviceCertificate)
+	handler.router.HandleFunc("GET /device/{key}/audit", handler.Audit)
+	handler.router.HandleFunc("GET /device/{key}/export", handler.ExportChain)
+	handler.router.HandleFunc("GET /device/{key}/transactions", handler.ListTransactions)
+	handler.router.HandleFunc("GET /device/{key}/transactions/{counter}", handler.FindTransaction)
 	handler.router.HandleFunc("POST /device", handler.CreateDevice)
+	handler.router.HandleFunc("POST /device/{key}/deactivate", handler.DeactivateDevice)
+	handler.router.HandleFunc("POST /device/{key}/reactivate", handler.ReactivateDevice)
+	handler.router.HandleFunc("POST /device/{key}/decommission", handler.DecommissionDevice)
+	handler.router.HandleFunc("POST /device/{key}/rotate", handler.RotateDeviceKey)
+	handler.router.HandleFunc("POST /device/{key}/transactions:batch", handler.CreateTransactions)
 	handler.router.HandleFunc("POST /transaction", handler.CreateTransaction)
+	handler.router.HandleFunc("POST /verify", handler.VerifySignature)
+	handler.router.HandleFunc("GET /jwks", handler.JWKS)
+	handler.router.HandleFunc("GET /ca", handler.CertificateAuthority)
+	handler.router.HandleFunc("GET /crl", handler.RevocationList)
 
 	return handler
 }
 
 // Handler provides API compatible with HTTP and REST standards.
 type Handler struct {
-	router  *http.ServeMux
-	storage Storage
+	router            *http.ServeMux
+	storage           Storage
+	authority         *cryptic.CertificateAuthority
+	idempotencyWindow time.Duration
 }
 
 // ServeHTTP is used for joining handlers to HTTP server.
@@ -46,105 +87,484 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.router.ServeHTTP(w, r)
 }
 
-// ListDevices serves all currently stored devices.
+// ListDevices serves a page of devices filtered by `algorithm`, `label` substring and `status`, ordered by `sort` field in `order`.
+// The page starts right after the `cursor` returned with the previous page and holds up to `limit` devices.
 func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
-	devices, err := h.storage.ListDevices(r.Context())
+	query := r.URL.Query()
+
+	var input ListDevicesInput
+
+	if value := query.Get("algorithm"); value != "" {
+		if _, err := lookupAlgorithm(Algorithm(value)); err != nil {
+			writeProblem(w, r, invalidField(InQuery, "algorithm", err))
+			return
+		}
+
+		input.Algorithm = Algorithm(value)
+	}
+
+	input.Label = query.Get("label")
+
+	if value := DeviceStatus(query.Get("status")); value != "" {
+		if _, known := transitions[value]; !known {
+			writeProblem(w, r, ErrInvalidStatus)
+			return
+		}
+
+		input.Status = value
+	}
+
+	sort, err := ParseDeviceSort(query.Get("sort"))
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	input.Sort = sort
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		input.Descending = true
+	default:
+		writeProblem(w, r, ErrInvalidOrder)
+		return
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeDeviceCursor(value)
+		if err != nil {
+			writeProblem(w, r, err)
+			return
+		}
+
+		input.After = &cursor
+	}
+
+	limit, err := parseLimit(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	// One more device than requested tells whether there is a next page.
+	input.Limit = limit + 1
 
-	if err := json.NewEncoder(w).Encode(devices); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	devices, err := h.storage.ListDevices(r.Context(), input)
+	if err != nil {
+		writeProblem(w, r, err)
 		return
 	}
+
+	page := DevicePage{Devices: NewDeviceResponses(devices)}
+	if len(devices) > limit {
+		page.Devices = page.Devices[:limit]
+		page.NextCursor = encodeDeviceCursor(NewDeviceCursor(devices[limit-1]))
+	}
+
+	writeJSON(w, r, http.StatusOK, page)
 }
 
 // FindDevice serves device with given by user key.
 func (h *Handler) FindDevice(w http.ResponseWriter, r *http.Request) {
-	key, err := uuid.Parse(r.PathValue("key"))
+	key, err := pathKey(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, err)
 		return
 	}
 
 	device, err := h.storage.FindDevice(r.Context(), key)
-	if errors.Is(err, ErrDeviceNotFound) {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	if err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	writeJSON(w, r, http.StatusOK, NewDeviceResponse(device))
+}
+
+// CreateDevice saves device to datastore.
+func (h *Handler) CreateDevice(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Key           uuid.UUID `json:"key"`
+		Algorithm     Algorithm `json:"algorithm"`
+		Label         Label     `json:"label"`
+		Bits          int       `json:"bits"`
+		Curve         string    `json:"curve"`
+		Scheme        string    `json:"scheme"`
+		Hash          string    `json:"hash"`
+		Encoding      string    `json:"encoding"`
+		PrivateKey    *string   `json:"privateKey"`
+		KeyHandle     *string   `json:"keyHandle"`
+		Counter       int64     `json:"counter"`
+		LastSignature string    `json:"lastSignature"`
+	}
+
+	if err := decodeBody(r, &body, false); err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	input := CreateDeviceInput{
+		Key:           body.Key,
+		Algorithm:     body.Algorithm,
+		Label:         body.Label,
+		Bits:          body.Bits,
+		Curve:         body.Curve,
+		Scheme:        body.Scheme,
+		Hash:          body.Hash,
+		Encoding:      body.Encoding,
+		Counter:       body.Counter,
+		LastSignature: body.LastSignature,
+	}
+
+	if body.PrivateKey != nil {
+		input.PrivateKey = []byte(*body.PrivateKey)
+	}
 
-	if err := json.NewEncoder(w).Encode(device); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if body.KeyHandle != nil {
+		input.KeyHandle = []byte(*body.KeyHandle)
+	}
+
+	device, err := h.storage.CreateDevice(r.Context(), input)
+	if err != nil {
+		writeProblem(w, r, err)
 		return
 	}
+
+	writeJSON(w, r, http.StatusCreated, NewDeviceResponse(device))
 }
 
-// CreateDevice saves device to datastore.
-func (h *Handler) CreateDevice(w http.ResponseWriter, r *http.Request) {
+// DeactivateDevice suspends an active device, it cannot sign until it is reactivated.
+func (h *Handler) DeactivateDevice(w http.ResponseWriter, r *http.Request) {
+	h.changeDeviceStatus(w, r, StatusSuspended)
+}
+
+// ReactivateDevice activates a suspended device again.
+func (h *Handler) ReactivateDevice(w http.ResponseWriter, r *http.Request) {
+	h.changeDeviceStatus(w, r, StatusActive)
+}
+
+// DecommissionDevice takes a device out of service for good, its transactions stay readable.
+func (h *Handler) DecommissionDevice(w http.ResponseWriter, r *http.Request) {
+	h.changeDeviceStatus(w, r, StatusDecommissioned)
+}
+
+// changeDeviceStatus moves the device to the given state on behalf of `changedBy` from the request body.
+func (h *Handler) changeDeviceStatus(w http.ResponseWriter, r *http.Request, status DeviceStatus) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
 	var body struct {
-		Key       uuid.UUID `json:"key"`
-		Algorithm Algorithm `json:"algorithm"`
-		Label     Label     `json:"label"`
+		ChangedBy Actor `json:"changedBy"`
+	}
+
+	if err := decodeBody(r, &body, false); err != nil {
+		writeProblem(w, r, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if body.ChangedBy == "" {
+		writeProblem(w, r, ErrInvalidActor)
 		return
 	}
 
-	device, err := h.storage.CreateDevice(r.Context(), CreateDeviceInput(body))
+	device, err := h.storage.ChangeDeviceStatus(r.Context(), ChangeDeviceStatusInput{Key: key, Status: status, ChangedBy: body.ChangedBy})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, NewDeviceResponse(device))
+}
+
+// RotateDeviceKey replaces the key pair of the device, optionally with another algorithm given in the body.
+func (h *Handler) RotateDeviceKey(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	var body struct {
+		Algorithm Algorithm `json:"algorithm"`
+		Bits      int       `json:"bits"`
+		Curve     string    `json:"curve"`
+		Scheme    string    `json:"scheme"`
+		Hash      string    `json:"hash"`
+		Encoding  string    `json:"encoding"`
+	}
+
+	// The body is optional, without it the algorithm, key parameters and signature options of the device are kept.
+	if err := decodeBody(r, &body, true); err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	input := RotateDeviceKeyInput{
+		Key:       key,
+		Algorithm: body.Algorithm,
+		Bits:      body.Bits,
+		Curve:     body.Curve,
+		Scheme:    body.Scheme,
+		Hash:      body.Hash,
+		Encoding:  body.Encoding,
+	}
 
-	if err := json.NewEncoder(w).Encode(device); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	device, err := h.storage.RotateDeviceKey(r.Context(), input)
+	if err != nil {
+		writeProblem(w, r, err)
 		return
 	}
+
+	writeJSON(w, r, http.StatusOK, NewDeviceResponse(device))
 }
 
 // CreateTransaction saves transaction and modify device within.
+// Requests with an `Idempotency-Key` header are signed once, retries with the same key, device and data get the same transaction.
 func (h *Handler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		DeviceKey uuid.UUID `json:"deviceKey"`
 		Data      Data      `json:"data"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeBody(r, &body, false); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	input := CreateTransactionInput{DeviceKey: body.DeviceKey, Data: body.Data}
+
+	if values := r.Header.Values("Idempotency-Key"); len(values) > 0 {
+		if len(values) > 1 || !validIdempotencyKey(values[0]) {
+			writeProblem(w, r, ErrInvalidIdempotencyKey)
+			return
+		}
+
+		input.IdempotencyKey = values[0]
+		input.IdempotencyWindow = h.idempotencyWindow
+	}
+
+	transaction, err := h.storage.CreateTransaction(r.Context(), input)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, transaction)
+}
+
+// CreateTransactions signs a batch of data items with consecutive counters in the order given, either all of them or none.
+// Transactions are returned in the same order, one for every data item.
+func (h *Handler) CreateTransactions(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	// Items are decoded one by one, so an invalid item is reported with its index.
+	var body struct {
+		Data []json.RawMessage `json:"data"`
+	}
+
+	if err := decodeBody(r, &body, false); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	if len(body.Data) == 0 || len(body.Data) > MaxBatchSize {
+		writeProblem(w, r, ErrInvalidBatchSize)
+		return
+	}
+
+	input := CreateTransactionsInput{DeviceKey: key, Data: make([]Data, len(body.Data))}
+
+	for i, item := range body.Data {
+		if err := json.Unmarshal(item, &input.Data[i]); err != nil {
+			writeProblem(w, r, invalidField(InBody, fmt.Sprintf("data[%d]", i), fmt.Errorf("data item %d: %w", i, err)))
+			return
+		}
+	}
+
+	transactions, err := h.storage.CreateTransactions(r.Context(), input)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, TransactionBatch{Transactions: transactions})
+}
+
+// ListTransactions serves a page of device transactions ordered by counter.
+// The page starts at the `cursor` counter (0 by default) and holds up to `limit` transactions.
+func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	cursor := int64(0)
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		cursor, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || cursor < 0 {
+			writeProblem(w, r, ErrInvalidCursor)
+			return
+		}
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	// One more transaction than requested tells whether there is a next page.
+	transactions, err := h.storage.ListTransactions(r.Context(), ListTransactionsInput{DeviceKey: key, From: cursor, Limit: limit + 1})
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	page := TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = &transactions[limit].Counter
+	}
+
+	writeJSON(w, r, http.StatusOK, page)
+}
+
+// FindTransaction serves device transaction with given by user counter.
+func (h *Handler) FindTransaction(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
-	transaction, err := h.storage.CreateTransaction(r.Context(), CreateTransactionInput(body))
-	if errors.Is(err, ErrDeviceNotFound) {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	counter, err := strconv.ParseInt(r.PathValue("counter"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, invalidField(InPath, "counter", err))
 		return
 	}
 
+	transaction, err := h.storage.FindTransaction(r.Context(), key, counter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, transaction)
+}
+
+// VerifySignature checks whether the signature of signed data validates against the public key of the device.
+// A signature which does not validate is not an error of the request, it is reported as invalid with the reason.
+func (h *Handler) VerifySignature(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DeviceKey  uuid.UUID `json:"deviceKey"`
+		SignedData string    `json:"signedData"`
+		Signature  string    `json:"signature"`
+	}
+
+	if err := decodeBody(r, &body, false); err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	signature, err := base64.StdEncoding.DecodeString(body.Signature)
+	if err != nil {
+		writeProblem(w, r, invalidField(InBody, "signature", ErrSignatureNotBase64))
+		return
+	}
 
-	if err := json.NewEncoder(w).Encode(transaction); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	device, err := h.storage.FindDevice(r.Context(), body.DeviceKey)
+	if err != nil {
+		writeProblem(w, r, err)
 		return
 	}
+
+	verification := Verification{Valid: true}
+
+	if err := verifySignature(device, []byte(body.SignedData), signature); err != nil {
+		verification = Verification{Valid: false, Reason: err.Error()}
+	}
+
+	writeJSON(w, r, http.StatusOK, verification)
+}
+
+// eachDevice pages through all devices matching the input and calls fn for each of them, it stops at the first error.
+func (h *Handler) eachDevice(r *http.Request, input ListDevicesInput, fn func(Device) error) error {
+	input.Limit = MaxLimit
+
+	for {
+		devices, err := h.storage.ListDevices(r.Context(), input)
+		if err != nil {
+			return err
+		}
+
+		for _, device := range devices {
+			if err := fn(device); err != nil {
+				return err
+			}
+		}
+
+		if len(devices) < input.Limit {
+			return nil
+		}
+
+		cursor := NewDeviceCursor(devices[len(devices)-1])
+		input.After = &cursor
+	}
+}
+
+// pathKey reads the device key from the path.
+func pathKey(r *http.Request) (uuid.UUID, error) {
+	key, err := uuid.Parse(r.PathValue("key"))
+	if err != nil {
+		return uuid.Nil, invalidField(InPath, "key", err)
+	}
+
+	return key, nil
+}
+
+// parseLimit reads the page size from the `limit` query parameter, DefaultLimit is used when it is missing.
+func parseLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return DefaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > MaxLimit {
+		return 0, ErrInvalidLimit
+	}
+
+	return limit, nil
+}
+
+// encodeDeviceCursor encodes the cursor as an opaque URL safe string.
+func encodeDeviceCursor(cursor DeviceCursor) string {
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeDeviceCursor decodes the cursor encoded by encodeDeviceCursor.
+func decodeDeviceCursor(value string) (DeviceCursor, error) {
+	var cursor DeviceCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
 	"github.com/google/uuid"
@@ -13,24 +14,26 @@ import (
 func ExampleHandler_ListDevices() {
 	// Mock storage with predefined devices
 	store := &storage{
-		listDevices: func(_ context.Context) ([]signature.Device, error) {
+		listDevices: func(_ context.Context, _ signature.ListDevicesInput) ([]signature.Device, error) {
 			return []signature.Device{
 				{
 					Key:       uuid.MustParse("11111111-1111-1111-1111-111111111111"),
 					Label:     "Device 1",
 					Algorithm: signature.Algorithm("RSA"),
+					CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
 				},
 				{
 					Key:       uuid.MustParse("22222222-2222-2222-2222-222222222222"),
 					Label:     "Device 2",
 					Algorithm: signature.Algorithm("ECC"),
+					CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
 				},
 			}, nil
 		},
 	}
 
-	// Initialize the handler with the mock storage
-	handler := signature.NewHandler(store)
+	// Initialize the handler with the mock storage, listing devices needs no certificate authority
+	handler := signature.NewHandler(store, nil, signature.DefaultIdempotencyWindow)
 
 	// Create a new HTTP GET request to the /device endpoint
 	request := httptest.NewRequest(http.MethodGet, "/device", nil)
@@ -43,5 +46,5 @@ func ExampleHandler_ListDevices() {
 	fmt.Println(recorder.Body.String())
 
 	// Output:
-	// [{"key":"11111111-1111-1111-1111-111111111111","publicKey":null,"privateKey":null,"algorithm":"RSA","label":"Device 1","counter":0,"transactions":null},{"key":"22222222-2222-2222-2222-222222222222","publicKey":null,"privateKey":null,"algorithm":"ECC","label":"Device 2","counter":0,"transactions":null}]
+	// {"devices":[{"key":"11111111-1111-1111-1111-111111111111","algorithm":"RSA","label":"Device 1","counter":0,"publicKey":"","createdAt":"2024-01-01T00:00:00Z","status":"","statusChangedAt":"0001-01-01T00:00:00Z"},{"key":"22222222-2222-2222-2222-222222222222","algorithm":"ECC","label":"Device 2","counter":0,"publicKey":"","createdAt":"2024-01-02T00:00:00Z","status":"","statusChangedAt":"0001-01-01T00:00:00Z"}]}
 }
@@ -0,0 +1,71 @@
+package signature
+
+// idempotency.go implements idempotency keys of transaction signing shared by every storage implementation.
+// A client retrying a signing request sends the same `Idempotency-Key`, the retry returns the transaction signed first instead of signing
+// again and burning a counter. Keys are global and recorded with the device and the fingerprint of the data in the same step the transaction
+// is stored, so a retry either finds both or neither. A key reused with another device or other data is a conflict. Keys expire after
+// the idempotency window, expired keys are purged whenever a device signs and can be used again from then on.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultIdempotencyWindow is the time idempotency keys are kept for when the service is not configured otherwise.
+	DefaultIdempotencyWindow = 24 * time.Hour
+	// MaxIdempotencyKeyLength is the maximum number of characters of an idempotency key.
+	MaxIdempotencyKeyLength = 255
+)
+
+// idempotencyRecord represents an idempotency key with the device, the fingerprint of the data and the counter of the transaction signed for it.
+type idempotencyRecord struct {
+	deviceKey   uuid.UUID
+	fingerprint []byte
+	counter     int64
+	expiresAt   time.Time
+}
+
+// newIdempotencyRecord records the idempotency key of the input for the transaction signed now, it expires after the idempotency window.
+func newIdempotencyRecord(input CreateTransactionInput, counter int64, now time.Time) idempotencyRecord {
+	return idempotencyRecord{
+		deviceKey:   input.DeviceKey,
+		fingerprint: idempotencyFingerprint(input.Data),
+		counter:     counter,
+		expiresAt:   now.Add(input.IdempotencyWindow),
+	}
+}
+
+// idempotencyFingerprint hashes the data of a signing request, the device is recorded next to it.
+func idempotencyFingerprint(data Data) []byte {
+	fingerprint := sha256.Sum256([]byte(data))
+	return fingerprint[:]
+}
+
+// replay checks the retried request against the record, the transaction of the record is returned again unless the device or the data differs.
+func (r idempotencyRecord) replay(input CreateTransactionInput) error {
+	if r.deviceKey != input.DeviceKey || !bytes.Equal(r.fingerprint, idempotencyFingerprint(input.Data)) {
+		return ErrIdempotencyKeyConflict
+	}
+
+	return nil
+}
+
+// validIdempotencyKey checks the key has between 1 and 255 printable characters.
+func validIdempotencyKey(key string) bool {
+	if key == "" || len([]rune(key)) > MaxIdempotencyKeyLength {
+		return false
+	}
+
+	for _, r := range key {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+
+	return true
+}
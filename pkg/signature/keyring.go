@@ -0,0 +1,125 @@
+package signature
+
+// keyring.go implements envelope encryption of device key handles, which are the private keys for the software keystore.
+// Every device gets its own random data key which encrypts the key handle, the data key itself is wrapped by a master key.
+// Storages only ever hold ciphertext, the key handle is decrypted in the signing path and never kept.
+// Rotating the master key re-wraps data keys only, so device key pairs and their signatures stay untouched.
+
+import (
+	"fmt"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+)
+
+// Keyring holds master keys by their ID, data keys are always wrapped with the current one.
+// Retired master keys are kept only to unwrap data keys which were not re-wrapped yet.
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a keyring from master keys by their ID, the current ID has to be one of them.
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	if _, exists := keys[current]; !exists {
+		return nil, fmt.Errorf("%w: %q", ErrMasterKeyNotFound, current)
+	}
+
+	copied := make(map[string][]byte, len(keys))
+
+	for id, key := range keys {
+		if id == "" || len(key) != cryptic.KeySize {
+			return nil, fmt.Errorf("%w: %q must be %d bytes", ErrInvalidMasterKey, id, cryptic.KeySize)
+		}
+
+		copied[id] = key
+	}
+
+	return &Keyring{current: current, keys: copied}, nil
+}
+
+// Current returns the ID of the master key new data keys are wrapped with.
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Seal encrypts the plaintext key handle of the device with a new data key wrapped by the current master key.
+// The device key is authenticated with both ciphertexts, so they cannot be swapped between devices.
+func (k *Keyring) Seal(device Device) (Device, error) {
+	dataKey, err := cryptic.GenerateKey()
+	if err != nil {
+		return Device{}, err
+	}
+
+	handle, err := cryptic.Encrypt(dataKey, device.KeyHandle, device.Key[:])
+	if err != nil {
+		return Device{}, fmt.Errorf("error encrypting key handle: %w", err)
+	}
+
+	wrapped, err := cryptic.Encrypt(k.keys[k.current], dataKey, device.Key[:])
+	if err != nil {
+		return Device{}, fmt.Errorf("error wrapping data key: %w", err)
+	}
+
+	device.KeyHandle = handle
+	device.DataKey = wrapped
+	device.MasterKeyID = k.current
+
+	return device, nil
+}
+
+// Open decrypts the key handle of the device.
+func (k *Keyring) Open(device Device) ([]byte, error) {
+	dataKey, err := k.unwrap(device)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := cryptic.Decrypt(dataKey, device.KeyHandle, device.Key[:])
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting key handle: %w", err)
+	}
+
+	return handle, nil
+}
+
+// rewrap wraps the data key of the device with the current master key, devices already using it are returned as they are.
+// Devices without a master key hold a plaintext key handle from before encryption was introduced, they are sealed.
+func (k *Keyring) rewrap(device Device) (Device, error) {
+	if device.MasterKeyID == k.current {
+		return device, nil
+	}
+
+	if device.MasterKeyID == "" {
+		return k.Seal(device)
+	}
+
+	dataKey, err := k.unwrap(device)
+	if err != nil {
+		return Device{}, err
+	}
+
+	wrapped, err := cryptic.Encrypt(k.keys[k.current], dataKey, device.Key[:])
+	if err != nil {
+		return Device{}, fmt.Errorf("error wrapping data key: %w", err)
+	}
+
+	device.DataKey = wrapped
+	device.MasterKeyID = k.current
+
+	return device, nil
+}
+
+// unwrap decrypts the data key of the device with the master key it was wrapped with.
+func (k *Keyring) unwrap(device Device) ([]byte, error) {
+	master, exists := k.keys[device.MasterKeyID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrMasterKeyNotFound, device.MasterKeyID)
+	}
+
+	dataKey, err := cryptic.Decrypt(master, device.DataKey, device.Key[:])
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %w", err)
+	}
+
+	return dataKey, nil
+}
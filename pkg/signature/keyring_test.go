@@ -0,0 +1,70 @@
+package signature_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeyring_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		current string
+		keys    map[string][]byte
+		err     error
+	}{
+		{"Current key missing", "second", map[string][]byte{"first": bytes.Repeat([]byte{1}, 32)}, signature.ErrMasterKeyNotFound},
+		{"Short key", "first", map[string][]byte{"first": bytes.Repeat([]byte{1}, 16)}, signature.ErrInvalidMasterKey},
+		{"Empty ID", "first", map[string][]byte{"first": bytes.Repeat([]byte{1}, 32), "": bytes.Repeat([]byte{2}, 32)}, signature.ErrInvalidMasterKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := signature.NewKeyring(test.current, test.keys)
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestKeyring_Seal(t *testing.T) {
+	t.Parallel()
+
+	keyring, err := signature.NewKeyring("first", map[string][]byte{"first": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	_, private, err := cryptic.GenerateECDSAWithMarshal(cryptic.KeyParams{})
+	require.NoError(t, err)
+
+	device, err := keyring.Seal(signature.Device{Key: uuid.New(), KeyHandle: private})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, private, device.KeyHandle)
+	assert.NotEmpty(t, device.DataKey)
+	assert.Equal(t, "first", device.MasterKeyID)
+
+	opened, err := keyring.Open(device)
+	require.NoError(t, err)
+	assert.Equal(t, private, opened)
+
+	// Ciphertexts are bound to the device key, copying them to another device does not decrypt.
+	other := device
+	other.Key = uuid.New()
+
+	_, err = keyring.Open(other)
+	require.ErrorIs(t, err, cryptic.ErrDecryption)
+
+	unknown, err := signature.NewKeyring("second", map[string][]byte{"second": bytes.Repeat([]byte{2}, 32)})
+	require.NoError(t, err)
+
+	_, err = unknown.Open(device)
+	require.ErrorIs(t, err, signature.ErrMasterKeyNotFound)
+}
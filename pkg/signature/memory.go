@@ -1,51 +1,134 @@
 package signature
 
 // memory.go implements an in-memory storage system for managing signature devices and their transactions.
-// It provides concurrency-safe operations for listing, finding, and creating devices, as well as for creating transactions.
+// It provides concurrency-safe operations for paging through, finding, and creating devices, as well as for creating, listing and finding transactions.
 // The in-memory store is protected by a read-write mutex to ensure thread safety, and the devices are stored using their UUID as the key.
+// Signing, rotating and changing the status of a device are serialized by a mutex of its own, batches are signed without holding up other devices.
+// Private keys are kept by the keystore, key handles of the devices are kept encrypted by the keyring.
 
 import (
+	"bytes"
+	"cmp"
 	"context"
-	"encoding/base64"
-	"errors"
-	"strconv"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
 	"github.com/google/uuid"
 )
 
-// Memory represents an in-memory storage for devices with concurrency control.
+// Memory represents an in-memory storage for devices and their transactions with concurrency control.
+// Transactions of a device are kept ordered by counter, so the counter shifted by the imported counter is the index in the slice.
 type Memory struct {
-	mu      *sync.RWMutex
-	Devices map[uuid.UUID]Device
+	mu           *sync.RWMutex
+	keyStore     cryptic.KeyStore
+	keyring      *Keyring
+	policy       cryptic.KeyPolicy
+	authority    *cryptic.CertificateAuthority
+	Devices      map[uuid.UUID]Device
+	Transactions map[uuid.UUID][]Transaction
+	// idempotency holds the idempotency keys of all devices.
+	idempotency map[string]idempotencyRecord
+	// signers serialize signing, key rotations and status changes per device, so batches are signed without holding the store lock.
+	signers map[uuid.UUID]*sync.Mutex
 }
 
-// NewMemory initializes and returns a new Memory instance.
-func NewMemory() *Memory {
+// NewMemory initializes and returns a new Memory instance keeping private keys in the keystore and encrypting their handles with the keyring.
+// Keys of new devices have to meet the policy, the authority issues their certificates.
+func NewMemory(keyStore cryptic.KeyStore, keyring *Keyring, policy cryptic.KeyPolicy, authority *cryptic.CertificateAuthority) *Memory {
 	memory := &Memory{
-		mu:      &sync.RWMutex{},
-		Devices: map[uuid.UUID]Device{},
+		mu:           &sync.RWMutex{},
+		keyStore:     keyStore,
+		keyring:      keyring,
+		policy:       policy,
+		authority:    authority,
+		Devices:      map[uuid.UUID]Device{},
+		Transactions: map[uuid.UUID][]Transaction{},
+		idempotency:  map[string]idempotencyRecord{},
+		signers:      map[uuid.UUID]*sync.Mutex{},
 	}
 
 	return memory
 }
 
-// ListDevices retrieves a list of all devices from the memory store.
-func (m *Memory) ListDevices(_ context.Context) ([]Device, error) {
+// ListDevicesInput holds the input data for listing a page of devices.
+type ListDevicesInput struct {
+	// Algorithm keeps only devices using the algorithm, empty keeps all.
+	Algorithm Algorithm
+	// Label keeps only devices with the label containing it, case insensitive.
+	Label string
+	// Status keeps only devices in the state, empty keeps all.
+	Status DeviceStatus
+	// Sort is the field devices are ordered by, ties are broken by the device key.
+	Sort DeviceSort
+	// Descending reverses the order.
+	Descending bool
+	// After is the position of the last device on the previous page, nil starts from the first device.
+	After *DeviceCursor
+	// Limit is the maximum number of devices on the page.
+	Limit int
+}
+
+// ListDevices retrieves a page of filtered and ordered devices from the memory store.
+func (m *Memory) ListDevices(_ context.Context, input ListDevicesInput) ([]Device, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	var i int
+	label := strings.ToLower(input.Label)
+	devices := []Device{}
+
+	for _, device := range m.Devices {
+		if input.Algorithm != "" && device.Algorithm != input.Algorithm {
+			continue
+		}
+
+		if !strings.Contains(strings.ToLower(string(device.Label)), label) {
+			continue
+		}
+
+		if input.Status != "" && device.Status != input.Status {
+			continue
+		}
+
+		if input.After != nil && compareDevices(NewDeviceCursor(device), *input.After, input.Sort, input.Descending) <= 0 {
+			continue
+		}
+
+		devices = append(devices, device)
+	}
+
+	slices.SortFunc(devices, func(a, b Device) int {
+		return compareDevices(NewDeviceCursor(a), NewDeviceCursor(b), input.Sort, input.Descending)
+	})
 
-	devices := make([]Device, len(m.Devices))
+	return devices[:min(len(devices), max(input.Limit, 0))], nil
+}
 
-	for _, v := range m.Devices {
-		devices[i] = v
-		i++
+// compareDevices orders devices by the sort field and then by key, descending order reverses both.
+func compareDevices(a, b DeviceCursor, sort DeviceSort, descending bool) int {
+	var order int
+
+	switch sort {
+	case SortByLabel:
+		order = strings.Compare(string(a.Label), string(b.Label))
+	case SortByCounter:
+		order = cmp.Compare(a.Counter, b.Counter)
+	default:
+		order = a.CreatedAt.Compare(b.CreatedAt)
 	}
 
-	return devices, nil
+	if order == 0 {
+		order = bytes.Compare(a.Key[:], b.Key[:])
+	}
+
+	if descending {
+		return -order
+	}
+
+	return order
 }
 
 // FindDevice finds a device in the memory store by its UUID key.
@@ -66,34 +149,46 @@ type CreateDeviceInput struct {
 	Key       uuid.UUID
 	Algorithm Algorithm
 	Label     Label
+	// Bits is the modulus size of RSA keys and Curve the curve of ECDSA keys, empty values select the defaults.
+	Bits  int
+	Curve string
+	// Scheme is the RSA signature scheme, Hash the hash function and Encoding the encoding of ECDSA signatures, empty values select the defaults.
+	Scheme   string
+	Hash     string
+	Encoding string
+	// PrivateKey imports an external PEM or PKCS#8 private key instead of generating a new one.
+	PrivateKey []byte
+	// KeyHandle references a key already kept by the keystore instead of generating a new one.
+	KeyHandle []byte
+	// Counter continues the signature chain of a device migrated from another system, LastSignature is the base64
+	// encoded signature of the transaction before it. Both are empty for new devices.
+	Counter       int64
+	LastSignature string
 }
 
 // CreateDevice creates a new device in the memory store.
-func (m *Memory) CreateDevice(ctx context.Context, input CreateDeviceInput) (Device, error) {
-	if _, err := m.FindDevice(ctx, input.Key); !errors.Is(err, ErrDeviceNotFound) {
-		return Device{}, ErrDeviceAlreadyExists
+func (m *Memory) CreateDevice(_ context.Context, input CreateDeviceInput) (Device, error) {
+	m.mu.RLock()
+	keyring := m.keyring
+	m.mu.RUnlock()
+
+	device, err := generateDevice(m.keyStore, keyring, m.policy, m.authority, input)
+	if err != nil {
+		return Device{}, err
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	keys := cryptic.GenerateECDSAWithMarshal
-	if input.Algorithm == RSA {
-		keys = cryptic.GenerateRSAWithMarshal
+	// Existence is checked under the write lock, otherwise two concurrent creations could both pass the check.
+	if _, exists := m.Devices[input.Key]; exists {
+		return Device{}, ErrDeviceAlreadyExists
 	}
 
-	public, private, err := keys()
+	// The master key could have been rotated while the key pair was generated.
+	device, err = m.keyring.rewrap(device)
 	if err != nil {
-		return Device{}, nil
-	}
-
-	device := Device{
-		Key:          input.Key,
-		Algorithm:    input.Algorithm,
-		PublicKey:    public,
-		PrivateKey:   private,
-		Label:        input.Label,
-		Transactions: []Transaction{},
+		return Device{}, err
 	}
 
 	m.Devices[input.Key] = device
@@ -105,44 +200,295 @@ func (m *Memory) CreateDevice(ctx context.Context, input CreateDeviceInput) (Dev
 type CreateTransactionInput struct {
 	DeviceKey uuid.UUID
 	Data      Data
+	// IdempotencyKey identifies retries of the request, a retry within the IdempotencyWindow returns the transaction signed first.
+	// Empty signs every time.
+	IdempotencyKey    string
+	IdempotencyWindow time.Duration
 }
 
 // CreateTransaction creates a new transaction associated with a device and updates the device state.
-func (m *Memory) CreateTransaction(ctx context.Context, input CreateTransactionInput) (Transaction, error) {
-	device, err := m.FindDevice(ctx, input.DeviceKey)
+// The device is read and written under the same write lock, so concurrent signers never observe the same counter
+// and concurrent retries never sign twice. It waits for batches of the device being signed.
+func (m *Memory) CreateTransaction(_ context.Context, input CreateTransactionInput) (Transaction, error) {
+	signer, err := m.signer(input.DeviceKey)
 	if err != nil {
 		return Transaction{}, err
 	}
 
+	signer.Lock()
+	defer signer.Unlock()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	previous := base64.StdEncoding.EncodeToString([]byte(device.Key.String()))
-	if device.Counter > 0 {
-		previous = device.Transactions[len(device.Transactions)-1].Signature
+	device, exists := m.Devices[input.DeviceKey]
+	if !exists {
+		return Transaction{}, ErrDeviceNotFound
 	}
 
-	data := strconv.FormatInt(device.Counter, 10) + "." + string(input.Data) + "." + previous
+	transactions := m.Transactions[device.Key]
+	now := time.Now()
+
+	maps.DeleteFunc(m.idempotency, func(_ string, record idempotencyRecord) bool { return !now.Before(record.expiresAt) })
 
-	sign := cryptic.UnmarshalECDSAWithSign
-	if device.Algorithm == RSA {
-		sign = cryptic.UnmarshalRSAWithSign
+	if record, exists := m.idempotency[input.IdempotencyKey]; exists && input.IdempotencyKey != "" {
+		if err := record.replay(input); err != nil {
+			return Transaction{}, err
+		}
+
+		return transactions[record.counter-device.ImportedCounter], nil
 	}
 
-	signature, err := sign([]byte(data), device.PrivateKey)
+	transaction, err := signTransaction(m.keyStore, m.keyring, device, m.lastSignature(device), input.Data)
 	if err != nil {
 		return Transaction{}, err
 	}
 
-	transaction := Transaction{
-		Signature:  string(signature),
-		SignedData: data,
+	if input.IdempotencyKey != "" {
+		m.idempotency[input.IdempotencyKey] = newIdempotencyRecord(input, device.Counter, now)
 	}
 
-	device.Transactions = append(device.Transactions, transaction)
 	device.Counter++
 
+	m.Transactions[device.Key] = append(transactions, transaction)
 	m.Devices[device.Key] = device
 
 	return transaction, nil
 }
+
+// CreateTransactionsInput holds the input data for signing a batch of transactions.
+type CreateTransactionsInput struct {
+	DeviceKey uuid.UUID
+	Data      []Data
+}
+
+// CreateTransactions signs a batch of transactions with consecutive counters and updates the device state.
+// The batch is signed under the signer of the device rather than the store lock, so other devices are not held up by it.
+// The signer keeps the counter, key and status of the device as they were read until the batch is stored, which happens only
+// when every item was signed.
+func (m *Memory) CreateTransactions(_ context.Context, input CreateTransactionsInput) ([]Transaction, error) {
+	signer, err := m.signer(input.DeviceKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer.Lock()
+	defer signer.Unlock()
+
+	m.mu.RLock()
+	device := m.Devices[input.DeviceKey]
+	keyring := m.keyring
+	last := m.lastSignature(device)
+	m.mu.RUnlock()
+
+	signed, _, err := signTransactions(m.keyStore, keyring, device, last, input.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	m.storeTransactions(device.Key, signed)
+
+	return signed, nil
+}
+
+// signer returns the mutex serializing the signers of the device, only existing devices get one.
+func (m *Memory) signer(key uuid.UUID) (*sync.Mutex, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.Devices[key]; !exists {
+		return nil, ErrDeviceNotFound
+	}
+
+	signer, exists := m.signers[key]
+	if !exists {
+		signer = &sync.Mutex{}
+		m.signers[key] = signer
+	}
+
+	return signer, nil
+}
+
+// lastSignature returns the signature the next transaction of the device chains, the caller holds the store lock.
+func (m *Memory) lastSignature(device Device) string {
+	transactions := m.Transactions[device.Key]
+	if len(transactions) == 0 {
+		return device.ImportedSignature
+	}
+
+	return transactions[len(transactions)-1].Signature
+}
+
+// storeTransactions stores the transactions signed by the device and advances its counter past them, the caller holds its signer.
+// Only the counter is taken over, the data key of the device could have been re-wrapped meanwhile.
+func (m *Memory) storeTransactions(key uuid.UUID, signed []Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device := m.Devices[key]
+	device.Counter += int64(len(signed))
+
+	m.Transactions[key] = append(m.Transactions[key], signed...)
+	m.Devices[key] = device
+}
+
+// ChangeDeviceStatusInput holds the input data for changing the lifecycle state of a device.
+type ChangeDeviceStatusInput struct {
+	Key       uuid.UUID
+	Status    DeviceStatus
+	ChangedBy Actor
+}
+
+// ChangeDeviceStatus moves a device in the memory store to the next lifecycle state, it waits for batches of the device being signed.
+func (m *Memory) ChangeDeviceStatus(_ context.Context, input ChangeDeviceStatusInput) (Device, error) {
+	signer, err := m.signer(input.Key)
+	if err != nil {
+		return Device{}, err
+	}
+
+	signer.Lock()
+	defer signer.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, exists := m.Devices[input.Key]
+	if !exists {
+		return Device{}, ErrDeviceNotFound
+	}
+
+	device, err = changeStatus(device, input)
+	if err != nil {
+		return Device{}, err
+	}
+
+	m.Devices[device.Key] = device
+
+	return device, nil
+}
+
+// RotateMasterKey re-wraps data keys of all devices with the current master key of the keyring and switches the store to it.
+// The keyring has to hold the master keys the data keys are wrapped with, nothing is changed when any of them is missing.
+// It returns the number of re-wrapped devices.
+func (m *Memory) RotateMasterKey(_ context.Context, keyring *Keyring) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rewrapped := map[uuid.UUID]Device{}
+
+	for key, device := range m.Devices {
+		if device.MasterKeyID == keyring.Current() {
+			continue
+		}
+
+		device, err := keyring.rewrap(device)
+		if err != nil {
+			return 0, err
+		}
+
+		rewrapped[key] = device
+	}
+
+	for key, device := range rewrapped {
+		m.Devices[key] = device
+	}
+
+	m.keyring = keyring
+
+	return len(rewrapped), nil
+}
+
+// RotateDeviceKeyInput holds the input data for replacing the key pair of a device.
+type RotateDeviceKeyInput struct {
+	Key uuid.UUID
+	// Algorithm of the new key pair, empty keeps the algorithm of the device.
+	Algorithm Algorithm
+	// Bits, Curve, Scheme, Hash and Encoding of the new key pair, empty values keep those of the device when its algorithm is kept.
+	// Rotating with a new encoding moves devices off the legacy encoding, the retired key keeps verifying with its own.
+	Bits     int
+	Curve    string
+	Scheme   string
+	Hash     string
+	Encoding string
+}
+
+// RotateDeviceKey replaces the key pair of a device in the memory store, the previous public key is kept in its history.
+// The key is generated under the write lock and the signer of the device, so no transaction is signed with the retired key once its range
+// is recorded. It waits for batches of the device being signed.
+func (m *Memory) RotateDeviceKey(_ context.Context, input RotateDeviceKeyInput) (Device, error) {
+	signer, err := m.signer(input.Key)
+	if err != nil {
+		return Device{}, err
+	}
+
+	signer.Lock()
+	defer signer.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	device, exists := m.Devices[input.Key]
+	if !exists {
+		return Device{}, ErrDeviceNotFound
+	}
+
+	device, err = rotateKey(m.keyStore, m.keyring, m.policy, m.authority, device, input)
+	if err != nil {
+		return Device{}, err
+	}
+
+	m.Devices[device.Key] = device
+
+	return device, nil
+}
+
+// ListTransactionsInput holds the input data for listing a page of device transactions.
+type ListTransactionsInput struct {
+	DeviceKey uuid.UUID
+	// From is the counter of the first transaction on the page.
+	From int64
+	// Limit is the maximum number of transactions on the page.
+	Limit int
+}
+
+// ListTransactions retrieves transactions of a device ordered by counter, starting from the given counter.
+func (m *Memory) ListTransactions(_ context.Context, input ListTransactionsInput) ([]Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	device, exists := m.Devices[input.DeviceKey]
+	if !exists {
+		return nil, ErrDeviceNotFound
+	}
+
+	transactions := m.Transactions[input.DeviceKey]
+
+	from := min(max(input.From-device.ImportedCounter, 0), int64(len(transactions)))
+	to := min(from+int64(max(input.Limit, 0)), int64(len(transactions)))
+
+	page := make([]Transaction, to-from)
+	copy(page, transactions[from:to])
+
+	return page, nil
+}
+
+// FindTransaction finds a transaction of a device by its counter.
+func (m *Memory) FindTransaction(_ context.Context, deviceKey uuid.UUID, counter int64) (Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	device, exists := m.Devices[deviceKey]
+	if !exists {
+		return Transaction{}, ErrDeviceNotFound
+	}
+
+	// Transactions signed before the device was imported are kept by the previous system.
+	transactions := m.Transactions[deviceKey]
+
+	index := counter - device.ImportedCounter
+	if index < 0 || index >= int64(len(transactions)) {
+		return Transaction{}, ErrTransactionNotFound
+	}
+
+	return transactions[index], nil
+}
@@ -1,11 +1,17 @@
 package signature_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature/storagetest"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,7 +20,7 @@ import (
 func TestFindDevice(t *testing.T) {
 	t.Parallel()
 
-	store := signature.NewMemory()
+	store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), storagetest.NewKeyring(t, "first"), cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
 	key := uuid.New()
 	expected := signature.Device{Key: key, Label: "Test Device"}
 	store.Devices[key] = expected
@@ -42,7 +48,7 @@ func TestFindDevice(t *testing.T) {
 func TestCreateDevice(t *testing.T) {
 	t.Parallel()
 
-	store := signature.NewMemory()
+	store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), storagetest.NewKeyring(t, "first"), cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
 	ctx := context.Background()
 
 	t.Run("Successful ECDSA device creation", func(t *testing.T) {
@@ -92,19 +98,23 @@ func TestCreateDevice(t *testing.T) {
 func TestCreateTransaction(t *testing.T) {
 	t.Parallel()
 
-	store := signature.NewMemory()
+	keyring := storagetest.NewKeyring(t, "first")
+	store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), keyring, cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
 	ctx := context.Background()
 	deviceID := uuid.New()
 
-	_, private, _ := cryptic.GenerateECDSAWithMarshal()
+	_, private, _ := cryptic.GenerateECDSAWithMarshal(cryptic.KeyParams{})
+
+	device, err := keyring.Seal(signature.Device{
+		Key:       deviceID,
+		Algorithm: signature.ECC,
+		Counter:   0,
+		Label:     "Test ECDSA Device",
+		KeyHandle: private,
+		Status:    signature.StatusActive,
+	})
+	require.NoError(t, err)
 
-	device := signature.Device{
-		Key:        deviceID,
-		Algorithm:  signature.ECC,
-		Counter:    0,
-		Label:      "Test ECDSA Device",
-		PrivateKey: private,
-	}
 	store.Devices[deviceID] = device
 
 	t.Run("Successful transaction creation", func(t *testing.T) {
@@ -118,9 +128,9 @@ func TestCreateTransaction(t *testing.T) {
 
 		// Assertions
 		require.NoError(t, err)
-		assert.Contains(t, transaction.SignedData, "0.transaction-data")
+		assert.Equal(t, "0_transaction-data_"+base64.StdEncoding.EncodeToString([]byte(deviceID.String())), transaction.SignedData)
 		assert.Equal(t, int64(1), store.Devices[deviceID].Counter)
-		assert.Len(t, store.Devices[deviceID].Transactions, 1)
+		assert.Len(t, store.Transactions[deviceID], 1)
 	})
 
 	t.Run("Device not found", func(t *testing.T) {
@@ -138,3 +148,292 @@ func TestCreateTransaction(t *testing.T) {
 		assert.Equal(t, signature.Transaction{}, transaction)
 	})
 }
+
+func TestMemory_Storage(t *testing.T) {
+	t.Parallel()
+
+	storagetest.Run(t, func(keyring *signature.Keyring) signature.Storage {
+		return signature.NewMemory(cryptic.NewSoftwareKeyStore(), keyring, cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+	})
+}
+
+func TestCreateTransaction_RegisteredAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	// A new algorithm only has to be registered in cryptic, the signature package stays untouched.
+	algorithm := cryptic.NewECCAlgorithm()
+	algorithm.Name = "TEST_" + uuid.NewString()
+	require.NoError(t, cryptic.Register(algorithm))
+
+	var name signature.Algorithm
+	require.NoError(t, json.Unmarshal([]byte(`"`+algorithm.Name+`"`), &name))
+	require.ErrorIs(t, json.Unmarshal([]byte(`"UNKNOWN"`), &name), signature.ErrInvalidAlgorithm)
+
+	store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), storagetest.NewKeyring(t, "first"), cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+
+	device, err := store.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: name})
+	require.NoError(t, err)
+
+	transaction, err := store.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+	require.NoError(t, err)
+	signed, err := base64.StdEncoding.DecodeString(transaction.Signature)
+	require.NoError(t, err)
+	require.NoError(t, algorithm.Verify([]byte(transaction.SignedData), signed, device.PublicKey, cryptic.SignatureOptions{}))
+}
+
+func TestMemory_PrivateKeyEncrypted(t *testing.T) {
+	t.Parallel()
+
+	keyring := storagetest.NewKeyring(t, "first")
+	store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), keyring, cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+
+	device, err := store.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC})
+	require.NoError(t, err)
+
+	stored := store.Devices[device.Key]
+	assert.NotContains(t, string(stored.KeyHandle), "PRIVATE KEY")
+	assert.Equal(t, "first", stored.MasterKeyID)
+
+	private, err := keyring.Open(stored)
+	require.NoError(t, err)
+	assert.Contains(t, string(private), "PRIVATE KEY")
+
+	_, err = cryptic.NewECCMarshaler().Unmarshal(private)
+	require.NoError(t, err)
+}
+
+// custodialKeyStore keeps private keys to itself and hands out random handles, like an HSM does.
+type custodialKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func (c *custodialKeyStore) Generate(algorithm string, params cryptic.KeyParams) ([]byte, []byte, error) {
+	private, public, err := cryptic.NewSoftwareKeyStore().Generate(algorithm, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handle := uuid.NewString()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys[handle] = private
+
+	return []byte(handle), public, nil
+}
+
+func (c *custodialKeyStore) Sign(algorithm string, handle, data []byte, options cryptic.SignatureOptions) ([]byte, error) {
+	c.mu.Lock()
+	private, exists := c.keys[string(handle)]
+	c.mu.Unlock()
+
+	if !exists {
+		return nil, cryptic.ErrKeyNotFound
+	}
+
+	return cryptic.NewSoftwareKeyStore().Sign(algorithm, private, data, options)
+}
+
+func (c *custodialKeyStore) Import(algorithm string, private []byte) ([]byte, []byte, error) {
+	key, public, err := cryptic.NewSoftwareKeyStore().Import(algorithm, private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handle := uuid.NewString()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys[handle] = key
+
+	return []byte(handle), public, nil
+}
+
+func (c *custodialKeyStore) Resolve(string, []byte) ([]byte, error) {
+	return nil, cryptic.ErrNotSupported
+}
+
+func TestMemory_KeyStore(t *testing.T) {
+	t.Parallel()
+
+	keyStore := &custodialKeyStore{keys: map[string][]byte{}}
+	keyring := storagetest.NewKeyring(t, "first")
+	store := signature.NewMemory(keyStore, keyring, cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+
+	device, err := store.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.RSA})
+	require.NoError(t, err)
+
+	// Only the handle is kept with the device, the private key stays in the keystore.
+	handle, err := keyring.Open(store.Devices[device.Key])
+	require.NoError(t, err)
+	assert.Contains(t, keyStore.keys, string(handle))
+	assert.NotContains(t, string(handle), "PRIVATE")
+
+	for range 3 {
+		_, err := store.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		require.NoError(t, err)
+	}
+
+	transactions := store.Transactions[device.Key]
+	storagetest.AssertChain(t, store.Devices[device.Key], transactions)
+
+	algorithm, err := cryptic.Lookup(string(signature.RSA))
+	require.NoError(t, err)
+
+	for _, transaction := range transactions {
+		signed, err := base64.StdEncoding.DecodeString(transaction.Signature)
+		require.NoError(t, err)
+		require.NoError(t, algorithm.Verify([]byte(transaction.SignedData), signed, device.PublicKey, cryptic.SignatureOptions{}))
+	}
+}
+
+func TestMemory_KeyPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := cryptic.KeyPolicy{MinRSABits: 3072, MinCurveBits: 384}
+	store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), storagetest.NewKeyring(t, "first"), policy, storagetest.Authority(t))
+	ctx := context.Background()
+
+	_, err := store.CreateDevice(ctx, signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.RSA})
+	require.ErrorIs(t, err, cryptic.ErrWeakKey, "default RSA keys are below the policy")
+
+	_, err = store.CreateDevice(ctx, signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC, Curve: "P-256"})
+	require.ErrorIs(t, err, cryptic.ErrWeakKey, "P-256 keys are below the policy")
+
+	_, private, err := cryptic.GenerateECDSAWithMarshal(cryptic.KeyParams{Curve: "P-256"})
+	require.NoError(t, err)
+
+	_, err = store.CreateDevice(ctx, signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC, PrivateKey: private})
+	require.ErrorIs(t, err, cryptic.ErrWeakKey, "imported keys are checked against the policy too")
+
+	assert.Empty(t, store.Devices, "no device must be created below the policy")
+
+	device, err := store.CreateDevice(ctx, signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC})
+	require.NoError(t, err)
+	assert.Equal(t, "P-384", device.Curve)
+}
+
+// blockingKeyStore signs like the software keystore, signing data containing `_blocked_` waits until release is closed.
+type blockingKeyStore struct {
+	cryptic.SoftwareKeyStore
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingKeyStore) Sign(algorithm string, handle, data []byte, options cryptic.SignatureOptions) ([]byte, error) {
+	if bytes.Contains(data, []byte("_blocked_")) {
+		b.blocked <- struct{}{}
+		<-b.release
+	}
+
+	return b.SoftwareKeyStore.Sign(algorithm, handle, data, options)
+}
+
+func TestMemory_ConcurrentBatches(t *testing.T) {
+	t.Parallel()
+
+	keyStore := &blockingKeyStore{blocked: make(chan struct{}), release: make(chan struct{})}
+	store := signature.NewMemory(keyStore, storagetest.NewKeyring(t, "first"), cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+	ctx := context.Background()
+
+	slow, err := store.CreateDevice(ctx, signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC})
+	require.NoError(t, err)
+
+	other, err := store.CreateDevice(ctx, signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC})
+	require.NoError(t, err)
+
+	batch := make(chan error)
+
+	go func() {
+		_, err := store.CreateTransactions(ctx, signature.CreateTransactionsInput{DeviceKey: slow.Key, Data: []signature.Data{"first", "blocked", "last"}})
+		batch <- err
+	}()
+
+	<-keyStore.blocked
+
+	// Other devices sign, and the device signing the batch is read, while the batch waits for its signature.
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, err := store.CreateTransactions(ctx, signature.CreateTransactionsInput{DeviceKey: other.Key, Data: []signature.Data{"first", "second"}})
+		assert.NoError(t, err)
+
+		_, err = store.CreateTransaction(ctx, signature.CreateTransactionInput{DeviceKey: other.Key, Data: "third"})
+		assert.NoError(t, err)
+
+		found, err := store.FindDevice(ctx, slow.Key)
+		assert.NoError(t, err)
+		assert.Zero(t, found.Counter, "the batch is stored once all of it is signed")
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("signing for another device waited for the batch")
+	}
+
+	close(keyStore.release)
+	require.NoError(t, <-batch)
+
+	for _, key := range []uuid.UUID{slow.Key, other.Key} {
+		device, err := store.FindDevice(ctx, key)
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, device.Counter)
+
+		transactions, err := store.ListTransactions(ctx, signature.ListTransactionsInput{DeviceKey: key, Limit: 10})
+		require.NoError(t, err)
+		storagetest.AssertChain(t, device, transactions)
+	}
+}
+
+func TestMemory_RotateDuringBatch(t *testing.T) {
+	t.Parallel()
+
+	keyStore := &blockingKeyStore{blocked: make(chan struct{}), release: make(chan struct{})}
+	store := signature.NewMemory(keyStore, storagetest.NewKeyring(t, "first"), cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+	ctx := context.Background()
+
+	device, err := store.CreateDevice(ctx, signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC})
+	require.NoError(t, err)
+
+	batch := make(chan error)
+
+	go func() {
+		_, err := store.CreateTransactions(ctx, signature.CreateTransactionsInput{DeviceKey: device.Key, Data: []signature.Data{"first", "blocked", "last"}})
+		batch <- err
+	}()
+
+	<-keyStore.blocked
+
+	rotated := make(chan error)
+
+	go func() {
+		_, err := store.RotateDeviceKey(ctx, signature.RotateDeviceKeyInput{Key: device.Key})
+		rotated <- err
+	}()
+
+	// The key is not rotated under the batch, it retires once the batch signed with it is stored.
+	select {
+	case <-rotated:
+		t.Fatal("the key was rotated while a batch was signed with it")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(keyStore.release)
+	require.NoError(t, <-batch)
+	require.NoError(t, <-rotated)
+
+	device, err = store.FindDevice(ctx, device.Key)
+	require.NoError(t, err)
+	require.Len(t, device.RetiredKeys, 1)
+	assert.EqualValues(t, 3, device.RetiredKeys[0].To)
+
+	transactions, err := store.ListTransactions(ctx, signature.ListTransactionsInput{DeviceKey: device.Key, Limit: 10})
+	require.NoError(t, err)
+	storagetest.AssertChain(t, device, transactions)
+}
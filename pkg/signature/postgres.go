@@ -1,48 +1,551 @@
 package signature
 
+// postgres.go implements a PostgreSQL storage for signature devices and their transactions.
+// The schema is provided by the `migrator` package. Signing happens inside a database transaction which locks
+// the device row, so concurrent signers on the same device are serialized and the counter has neither gaps nor duplicates.
+// Signatures are stored as raw bytes and base64 encoded only when they are read.
+// Private keys are kept by the keystore, key handles are stored encrypted by the keyring together with their wrapped data keys.
+// Idempotency keys are stored in their own table in the same database transaction as the transaction signed for them.
+
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-/*
-This is an example implementation of a PostgreSQL integration for the `signature` package.
-The `Postgres` struct provides basic methods for connecting to a PostgreSQL database,
-retrieving devices (via `ListDevices` and `FindDevice`), and managing database connections.
-It showcases how you can implement persistent storage for the signature API using SQL queries with `database/sql` in Go.
-*/
+// uniqueViolation is the PostgreSQL error code raised when a unique constraint is violated.
+const uniqueViolation = "23505"
+
+// deviceColumns lists columns of the devices table in the order scanned by scanDevice.
+const deviceColumns = "key, algorithm, label, public_key, key_handle, data_key, master_key_id, counter, created_at, status, status_changed_at, status_changed_by, " +
+	"retired_keys, imported_counter, imported_signature, bits, curve, scheme, hash, encoding, certificate"
+
+// transactionColumns lists columns of the transactions table in the order scanned by scanTransaction.
+const transactionColumns = "counter, signature, signed_data, algorithm, scheme, hash, encoding"
+
+// likeEscaper escapes wildcards of the LIKE pattern, so user input is matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
 
-// Ensures interface is implement for proof of concept.
+// Ensures interface is implemented.
 var _ Storage = &Postgres{}
 
-// NewPostgres initializes a new connection to the PostgreSQL database.
-func NewPostgres(p *pgxpool.Pool) *Postgres {
-	return &Postgres{pool: p}
+// NewPostgres initializes a new storage on top of the PostgreSQL connection pool
+// keeping private keys in the keystore and encrypting their handles with the keyring, keys of new devices have to meet the policy
+// and get their certificates from the authority.
+func NewPostgres(p *pgxpool.Pool, keyStore cryptic.KeyStore, keyring *Keyring, policy cryptic.KeyPolicy, authority *cryptic.CertificateAuthority) *Postgres {
+	postgres := &Postgres{pool: p, keyStore: keyStore, policy: policy, authority: authority}
+	postgres.keyring.Store(keyring)
+
+	return postgres
 }
 
-// Postgres represents a basic integration with a PostgreSQL database.
+// Postgres represents a storage for devices persisted in a PostgreSQL database.
 type Postgres struct {
-	pool *pgxpool.Pool
+	pool      *pgxpool.Pool
+	keyStore  cryptic.KeyStore
+	keyring   atomic.Pointer[Keyring]
+	policy    cryptic.KeyPolicy
+	authority *cryptic.CertificateAuthority
+}
+
+// ListDevices retrieves a page of filtered and ordered devices from the database.
+// Pages are selected by keyset on the sort column and key, labels are compared byte by byte like in Go.
+func (p *Postgres) ListDevices(ctx context.Context, input ListDevicesInput) ([]Device, error) {
+	column, direction, comparison := "created_at", "ASC", ">"
+
+	switch input.Sort {
+	case SortByLabel:
+		column = `label COLLATE "C"`
+	case SortByCounter:
+		column = "counter"
+	case SortByCreatedAt:
+	}
+
+	if input.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE ($1 = '' OR algorithm = $1) AND label ILIKE '%' || $2 || '%' AND ($3 = '' OR status = $3)`
+	args := []any{input.Algorithm, likeEscaper.Replace(input.Label), input.Status}
+
+	if input.After != nil {
+		var value any
+
+		switch input.Sort {
+		case SortByLabel:
+			value = input.After.Label
+		case SortByCounter:
+			value = input.After.Counter
+		default:
+			value = input.After.CreatedAt
+		}
+
+		query += fmt.Sprintf(` AND (%s, key) %s ($4, $5)`, column, comparison)
+		args = append(args, value, input.After.Key)
+	}
+
+	query += fmt.Sprintf(` ORDER BY %s %s, key %s LIMIT %d`, column, direction, direction, max(input.Limit, 0))
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying devices: %w", err)
+	}
+
+	devices, err := pgx.CollectRows(rows, scanDevice)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// FindDevice finds a device in the database by its UUID key.
+func (p *Postgres) FindDevice(ctx context.Context, key uuid.UUID) (Device, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+deviceColumns+` FROM devices WHERE key = $1`, key)
+	if err != nil {
+		return Device{}, fmt.Errorf("error querying device: %w", err)
+	}
+
+	device, err := pgx.CollectExactlyOneRow(rows, scanDevice)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Device{}, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return Device{}, fmt.Errorf("error scanning device: %w", err)
+	}
+
+	return device, nil
+}
+
+// CreateDevice creates a new device in the database.
+func (p *Postgres) CreateDevice(ctx context.Context, input CreateDeviceInput) (Device, error) {
+	device, err := generateDevice(p.keyStore, p.keyring.Load(), p.policy, p.authority, input)
+	if err != nil {
+		return Device{}, err
+	}
+
+	// The master key could have been rotated while the key pair was generated.
+	device, err = p.keyring.Load().rewrap(device)
+	if err != nil {
+		return Device{}, err
+	}
+
+	_, err = p.pool.Exec(ctx, `INSERT INTO devices (`+deviceColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+		COALESCE($13, '[]'), $14, $15, $16, $17, $18, $19, $20, $21)`,
+		device.Key, device.Algorithm, device.Label, device.PublicKey, device.KeyHandle, device.DataKey, device.MasterKeyID,
+		device.Counter, device.CreatedAt, device.Status, device.StatusChangedAt, device.StatusChangedBy, device.RetiredKeys,
+		device.ImportedCounter, device.ImportedSignature, device.Bits, device.Curve, device.Scheme, device.Hash, device.Encoding, device.Certificate)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return Device{}, ErrDeviceAlreadyExists
+	}
+
+	if err != nil {
+		return Device{}, fmt.Errorf("error inserting device: %w", err)
+	}
+
+	return device, nil
+}
+
+// CreateTransaction creates a new transaction associated with a device and updates the device counter.
+// The device row is locked until the transaction is committed, which serializes concurrent signers.
+func (p *Postgres) CreateTransaction(ctx context.Context, input CreateTransactionInput) (Transaction, error) {
+	var transaction Transaction
+
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		device, err := lockDevice(ctx, tx, input.DeviceKey)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		// Keys are global, the expired key of the request is purged along with those of the device which would otherwise never be.
+		_, err = tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE (device_key = $1 OR key = $2) AND expires_at <= $3`, device.Key, input.IdempotencyKey, now)
+		if err != nil {
+			return fmt.Errorf("error purging idempotency keys: %w", err)
+		}
+
+		if input.IdempotencyKey != "" {
+			replayed, found, err := replayTransaction(ctx, tx, input)
+			if err != nil || found {
+				transaction = replayed
+				return err
+			}
+		}
+
+		previous, err := lastSignature(ctx, tx, device)
+		if err != nil {
+			return err
+		}
+
+		transaction, err = signTransaction(p.keyStore, p.keyring.Load(), device, previous, input.Data)
+		if err != nil {
+			return err
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(transaction.Signature)
+		if err != nil {
+			return fmt.Errorf("error decoding signature: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO transactions (device_key, `+transactionColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			device.Key, device.Counter, signature, []byte(transaction.SignedData), transaction.Algorithm, transaction.Scheme, transaction.Hash, transaction.Encoding)
+		if err != nil {
+			return fmt.Errorf("error inserting transaction: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE devices SET counter = counter + 1 WHERE key = $1`, device.Key)
+		if err != nil {
+			return fmt.Errorf("error updating device counter: %w", err)
+		}
+
+		if input.IdempotencyKey != "" {
+			record := newIdempotencyRecord(input, device.Counter, now)
+
+			_, err = tx.Exec(ctx, `INSERT INTO idempotency_keys (key, device_key, fingerprint, counter, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+				input.IdempotencyKey, record.deviceKey, record.fingerprint, record.counter, record.expiresAt)
+
+			// A concurrent request signed for the same key with another device, signing for this one is rolled back.
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+				return ErrIdempotencyKeyConflict
+			}
+
+			if err != nil {
+				return fmt.Errorf("error inserting idempotency key: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+// CreateTransactions signs a batch of transactions with consecutive counters and updates the device counter.
+// The device row is locked and all transactions are copied in within one database transaction, so the batch is stored as a whole or not at all.
+func (p *Postgres) CreateTransactions(ctx context.Context, input CreateTransactionsInput) ([]Transaction, error) {
+	var transactions []Transaction
+
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		device, err := lockDevice(ctx, tx, input.DeviceKey)
+		if err != nil {
+			return err
+		}
+
+		previous, err := lastSignature(ctx, tx, device)
+		if err != nil {
+			return err
+		}
+
+		transactions, _, err = signTransactions(p.keyStore, p.keyring.Load(), device, previous, input.Data)
+		if err != nil {
+			return err
+		}
+
+		rows := make([][]any, len(transactions))
+
+		for i, transaction := range transactions {
+			signature, err := base64.StdEncoding.DecodeString(transaction.Signature)
+			if err != nil {
+				return fmt.Errorf("error decoding signature: %w", err)
+			}
+
+			rows[i] = []any{device.Key, transaction.Counter, signature, []byte(transaction.SignedData),
+				transaction.Algorithm, transaction.Scheme, transaction.Hash, transaction.Encoding}
+		}
+
+		columns := append([]string{"device_key"}, strings.Split(transactionColumns, ", ")...)
+
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"transactions"}, columns, pgx.CopyFromRows(rows))
+		if err != nil {
+			return fmt.Errorf("error inserting transactions: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE devices SET counter = counter + $2 WHERE key = $1`, device.Key, len(transactions))
+		if err != nil {
+			return fmt.Errorf("error updating device counter: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
 }
 
-// ListDevices implements Storage.
-func (p *Postgres) ListDevices(_ context.Context) ([]Device, error) {
-	panic("unimplemented")
+// lastSignature returns the base64 encoded signature the next transaction of the locked device is chained with.
+// Devices migrated from another system have no transaction before the first one signed here, they chain the imported signature.
+func lastSignature(ctx context.Context, tx pgx.Tx, device Device) (string, error) {
+	var last []byte
+
+	err := tx.QueryRow(ctx, `SELECT signature FROM transactions WHERE device_key = $1 AND counter = $2`, device.Key, device.Counter-1).Scan(&last)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return device.ImportedSignature, nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error querying last transaction: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(last), nil
 }
 
-// FindDevice implements Storage.
-func (p *Postgres) FindDevice(_ context.Context, _ uuid.UUID) (Device, error) {
-	panic("unimplemented")
+// replayTransaction finds the transaction signed for the idempotency key of the input, the device has to be locked and the expired key purged.
+// It reports whether the key was found, which is a conflict when the key was used with another device or other data.
+func replayTransaction(ctx context.Context, tx pgx.Tx, input CreateTransactionInput) (Transaction, bool, error) {
+	var record idempotencyRecord
+
+	err := tx.QueryRow(ctx, `SELECT device_key, fingerprint, counter, expires_at FROM idempotency_keys WHERE key = $1`,
+		input.IdempotencyKey).Scan(&record.deviceKey, &record.fingerprint, &record.counter, &record.expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Transaction{}, false, nil
+	}
+
+	if err != nil {
+		return Transaction{}, false, fmt.Errorf("error querying idempotency key: %w", err)
+	}
+
+	if err := record.replay(input); err != nil {
+		return Transaction{}, true, err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE device_key = $1 AND counter = $2`, record.deviceKey, record.counter)
+	if err != nil {
+		return Transaction{}, true, fmt.Errorf("error querying transaction: %w", err)
+	}
+
+	transaction, err := pgx.CollectExactlyOneRow(rows, scanTransaction)
+	if err != nil {
+		return Transaction{}, true, fmt.Errorf("error scanning transaction: %w", err)
+	}
+
+	return transaction, true, nil
 }
 
-// CreateDevice implements Storage.
-func (p *Postgres) CreateDevice(_ context.Context, _ CreateDeviceInput) (Device, error) {
-	panic("unimplemented")
+// ChangeDeviceStatus moves a device in the database to the next lifecycle state.
+// The device row is locked, so the status cannot change while a transaction is being signed.
+func (p *Postgres) ChangeDeviceStatus(ctx context.Context, input ChangeDeviceStatusInput) (Device, error) {
+	var device Device
+
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		locked, err := lockDevice(ctx, tx, input.Key)
+		if err != nil {
+			return err
+		}
+
+		device, err = changeStatus(locked, input)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE devices SET status = $2, status_changed_at = $3, status_changed_by = $4 WHERE key = $1`,
+			device.Key, device.Status, device.StatusChangedAt, device.StatusChangedBy)
+		if err != nil {
+			return fmt.Errorf("error updating device status: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Device{}, err
+	}
+
+	return device, nil
+}
+
+// RotateDeviceKey replaces the key pair of a device in the database, the previous public key is kept in its history.
+// The device row is locked, so no transaction is signed with the retired key once its range is recorded.
+func (p *Postgres) RotateDeviceKey(ctx context.Context, input RotateDeviceKeyInput) (Device, error) {
+	var device Device
+
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		locked, err := lockDevice(ctx, tx, input.Key)
+		if err != nil {
+			return err
+		}
+
+		device, err = rotateKey(p.keyStore, p.keyring.Load(), p.policy, p.authority, locked, input)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE devices SET algorithm = $2, public_key = $3, key_handle = $4, data_key = $5, master_key_id = $6, retired_keys = $7,
+			bits = $8, curve = $9, scheme = $10, hash = $11, encoding = $12, certificate = $13 WHERE key = $1`,
+			device.Key, device.Algorithm, device.PublicKey, device.KeyHandle, device.DataKey, device.MasterKeyID, device.RetiredKeys,
+			device.Bits, device.Curve, device.Scheme, device.Hash, device.Encoding, device.Certificate)
+		if err != nil {
+			return fmt.Errorf("error updating device key: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Device{}, err
+	}
+
+	return device, nil
 }
 
-// CreateTransaction implements Storage.
-func (p *Postgres) CreateTransaction(_ context.Context, _ CreateTransactionInput) (Transaction, error) {
-	panic("unimplemented")
+// RotateMasterKey re-wraps data keys of all devices with the current master key of the keyring and switches the storage to it.
+// All devices wrapped with another master key are locked and re-wrapped in a single database transaction, so either all of them
+// or none are changed. It returns the number of re-wrapped devices.
+func (p *Postgres) RotateMasterKey(ctx context.Context, keyring *Keyring) (int, error) {
+	var rewrapped int
+
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `SELECT `+deviceColumns+` FROM devices WHERE master_key_id <> $1 FOR UPDATE`, keyring.Current())
+		if err != nil {
+			return fmt.Errorf("error querying devices: %w", err)
+		}
+
+		devices, err := pgx.CollectRows(rows, scanDevice)
+		if err != nil {
+			return fmt.Errorf("error scanning devices: %w", err)
+		}
+
+		for _, device := range devices {
+			device, err := keyring.rewrap(device)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(ctx, `UPDATE devices SET key_handle = $2, data_key = $3, master_key_id = $4 WHERE key = $1`,
+				device.Key, device.KeyHandle, device.DataKey, device.MasterKeyID)
+			if err != nil {
+				return fmt.Errorf("error updating device data key: %w", err)
+			}
+		}
+
+		rewrapped = len(devices)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	p.keyring.Store(keyring)
+
+	return rewrapped, nil
+}
+
+// ListTransactions retrieves transactions of a device ordered by counter, starting from the given counter.
+func (p *Postgres) ListTransactions(ctx context.Context, input ListTransactionsInput) ([]Transaction, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE device_key = $1 AND counter >= $2 ORDER BY counter LIMIT $3`,
+		input.DeviceKey, input.From, max(input.Limit, 0))
+	if err != nil {
+		return nil, fmt.Errorf("error querying transactions: %w", err)
+	}
+
+	transactions, err := pgx.CollectRows(rows, scanTransaction)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning transactions: %w", err)
+	}
+
+	// An empty page is only valid for an existing device.
+	if len(transactions) == 0 {
+		if _, err := p.FindDevice(ctx, input.DeviceKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return transactions, nil
+}
+
+// FindTransaction finds a transaction of a device in the database by its counter.
+func (p *Postgres) FindTransaction(ctx context.Context, deviceKey uuid.UUID, counter int64) (Transaction, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE device_key = $1 AND counter = $2`, deviceKey, counter)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("error querying transaction: %w", err)
+	}
+
+	transaction, err := pgx.CollectExactlyOneRow(rows, scanTransaction)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := p.FindDevice(ctx, deviceKey); err != nil {
+			return Transaction{}, err
+		}
+
+		return Transaction{}, ErrTransactionNotFound
+	}
+
+	if err != nil {
+		return Transaction{}, fmt.Errorf("error scanning transaction: %w", err)
+	}
+
+	return transaction, nil
+}
+
+// lockDevice finds a device and locks its row until the end of the database transaction.
+func lockDevice(ctx context.Context, tx pgx.Tx, key uuid.UUID) (Device, error) {
+	rows, err := tx.Query(ctx, `SELECT `+deviceColumns+` FROM devices WHERE key = $1 FOR UPDATE`, key)
+	if err != nil {
+		return Device{}, fmt.Errorf("error querying device: %w", err)
+	}
+
+	device, err := pgx.CollectExactlyOneRow(rows, scanDevice)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Device{}, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return Device{}, fmt.Errorf("error scanning device: %w", err)
+	}
+
+	return device, nil
+}
+
+// scanDevice scans a single devices row.
+func scanDevice(row pgx.CollectableRow) (Device, error) {
+	var device Device
+
+	err := row.Scan(&device.Key, &device.Algorithm, &device.Label, &device.PublicKey, &device.KeyHandle, &device.DataKey, &device.MasterKeyID,
+		&device.Counter, &device.CreatedAt, &device.Status, &device.StatusChangedAt, &device.StatusChangedBy, &device.RetiredKeys,
+		&device.ImportedCounter, &device.ImportedSignature, &device.Bits, &device.Curve, &device.Scheme, &device.Hash, &device.Encoding, &device.Certificate)
+	device.CreatedAt = device.CreatedAt.UTC()
+	device.StatusChangedAt = device.StatusChangedAt.UTC()
+
+	// Devices never rotated have no history, the same as in other storages.
+	if len(device.RetiredKeys) == 0 {
+		device.RetiredKeys = nil
+	}
+
+	// Devices created before certificates were issued have none, the same as a device never given one.
+	if len(device.Certificate) == 0 {
+		device.Certificate = nil
+	}
+
+	return device, err
+}
+
+// scanTransaction scans a single transactions row, the stored raw signature is base64 encoded.
+func scanTransaction(row pgx.CollectableRow) (Transaction, error) {
+	var (
+		transaction           Transaction
+		signature, signedData []byte
+	)
+
+	err := row.Scan(&transaction.Counter, &signature, &signedData, &transaction.Algorithm, &transaction.Scheme, &transaction.Hash, &transaction.Encoding)
+	transaction.Signature = base64.StdEncoding.EncodeToString(signature)
+	transaction.SignedData = string(signedData)
+
+	return transaction, err
 }
@@ -0,0 +1,254 @@
+package signature
+
+// problem.go implements the error responses of the HTTP handlers as RFC 7807 problem details.
+// Every error is mapped to a problem by the sentinel error it wraps, which gives it a status and a stable code clients can rely on,
+// the detail is the error message. Errors of a single field of the request name it with where it was found, the body, a query
+// or path parameter or a header. Malformed requests and parameters are 400, well-formed bodies with invalid values are 422.
+// Errors which are not mapped are internal: they are logged and answered with a 500 which tells nothing about them.
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+)
+
+// MediaTypeProblem is the media type of error responses.
+const MediaTypeProblem = "application/problem+json"
+
+// problemTypePrefix prefixes the code of a problem to its type URI.
+const problemTypePrefix = "urn:signature:problem:"
+
+// Parts of a request an invalid field can be found in.
+const (
+	InBody   = "body"
+	InQuery  = "query"
+	InPath   = "path"
+	InHeader = "header"
+)
+
+// Codes of problems which are not bound to a single sentinel error.
+const (
+	CodeMalformedBody    = "malformed_body"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeValidationFailed = "validation_failed"
+	CodeInternalError    = "internal_error"
+)
+
+// Problem represents an error response, Code tells the kind of problem and Errors the fields of the request which caused it.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError represents an invalid field of a request, Field is the name of the parameter or header or the path of the body field.
+type FieldError struct {
+	In      string `json:"in"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// problemKind maps a sentinel error to its problem, errors of clients name the field they are found in unless the handler knows better.
+type problemKind struct {
+	err    error
+	status int
+	code   string
+	title  string
+	in     string
+	field  string
+}
+
+// problemKinds are matched in order, the first kind the error wraps wins.
+var problemKinds = []problemKind{
+	{ErrDeviceNotFound, http.StatusNotFound, "device_not_found", "Device not found", "", ""},
+	{ErrTransactionNotFound, http.StatusNotFound, "transaction_not_found", "Transaction not found", "", ""},
+	{ErrCertificateNotFound, http.StatusNotFound, "certificate_not_found", "Certificate not found", "", ""},
+	{ErrNotAcceptable, http.StatusNotAcceptable, "not_acceptable", "Not acceptable", InHeader, "Accept"},
+	{ErrDeviceAlreadyExists, http.StatusConflict, "device_already_exists", "Device already exists", "", ""},
+	{ErrDeviceNotActive, http.StatusConflict, "device_not_active", "Device is not active", "", ""},
+	{ErrDeviceDecommissioned, http.StatusConflict, "device_decommissioned", "Device is decommissioned", "", ""},
+	{ErrInvalidTransition, http.StatusConflict, "invalid_transition", "Device status cannot be changed", "", ""},
+	{ErrBodyTooLarge, http.StatusRequestEntityTooLarge, "body_too_large", "Body too large", "", ""},
+	{ErrIdempotencyKeyConflict, http.StatusUnprocessableEntity, "idempotency_key_conflict", "Idempotency key conflict", InHeader, "Idempotency-Key"},
+	{ErrInvalidIdempotencyKey, http.StatusBadRequest, "invalid_idempotency_key", "Invalid idempotency key", InHeader, "Idempotency-Key"},
+	{ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor", "Invalid cursor", InQuery, "cursor"},
+	{ErrInvalidLimit, http.StatusBadRequest, "invalid_limit", "Invalid limit", InQuery, "limit"},
+	{ErrInvalidSort, http.StatusBadRequest, "invalid_sort", "Invalid sort", InQuery, "sort"},
+	{ErrInvalidOrder, http.StatusBadRequest, "invalid_order", "Invalid order", InQuery, "order"},
+	{ErrInvalidStatus, http.StatusBadRequest, "invalid_status", "Invalid status", InQuery, "status"},
+	{ErrInvalidAlgorithm, http.StatusUnprocessableEntity, "invalid_algorithm", "Invalid algorithm", InBody, "algorithm"},
+	{ErrLabelTooLong, http.StatusUnprocessableEntity, "label_too_long", "Label too long", InBody, "label"},
+	{ErrDataIncorrectSize, http.StatusUnprocessableEntity, "invalid_data_size", "Invalid data size", InBody, "data"},
+	{ErrInvalidBatchSize, http.StatusUnprocessableEntity, "invalid_batch_size", "Invalid batch size", InBody, "data"},
+	{ErrInvalidActor, http.StatusUnprocessableEntity, "invalid_actor", "Invalid actor", InBody, "changedBy"},
+	{ErrKeyImportConflict, http.StatusUnprocessableEntity, "key_import_conflict", "Key import conflict", InBody, "keyHandle"},
+	{ErrInvalidChain, http.StatusUnprocessableEntity, "invalid_chain", "Invalid chain", InBody, "counter"},
+	{ErrSignatureNotBase64, http.StatusUnprocessableEntity, "signature_not_base64", "Signature not base64", InBody, "lastSignature"},
+	{cryptic.ErrInvalidPrivateKey, http.StatusUnprocessableEntity, "invalid_private_key", "Invalid private key", InBody, "privateKey"},
+	{cryptic.ErrKeyNotFound, http.StatusUnprocessableEntity, "key_not_found", "Key not found", InBody, "keyHandle"},
+	{cryptic.ErrKeyMismatch, http.StatusUnprocessableEntity, "key_mismatch", "Key mismatch", "", ""},
+	{cryptic.ErrWeakKey, http.StatusUnprocessableEntity, "weak_key", "Weak key", "", ""},
+	{cryptic.ErrInvalidKeyParams, http.StatusUnprocessableEntity, "invalid_key_params", "Invalid key parameters", "", ""},
+	{cryptic.ErrInvalidSignatureOptions, http.StatusUnprocessableEntity, "invalid_signature_options", "Invalid signature options", "", ""},
+	{cryptic.ErrNotSupported, http.StatusUnprocessableEntity, "not_supported", "Not supported", "", ""},
+	{ErrMalformedBody, http.StatusBadRequest, CodeMalformedBody, "Malformed body", InBody, ""},
+}
+
+// fieldError attributes an error to a field of the request, overriding the field of its problem kind.
+type fieldError struct {
+	in    string
+	field string
+	err   error
+}
+
+// invalidField attributes the error to the field found in the part of the request.
+func invalidField(in, field string, err error) error {
+	return &fieldError{in: in, field: field, err: err}
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// newProblem maps the error to its problem. Errors of parameters and headers are 400 whatever their kind,
+// unmapped errors of fields are 400 or 422 by where the field is and all other unmapped errors are internal.
+func newProblem(err error) Problem {
+	kind := problemKind{status: http.StatusInternalServerError, code: CodeInternalError, title: "Internal server error"}
+
+	for _, candidate := range problemKinds {
+		if errors.Is(err, candidate.err) {
+			kind = candidate
+			break
+		}
+	}
+
+	var field *fieldError
+	if errors.As(err, &field) {
+		if kind.code == CodeInternalError {
+			kind = problemKind{status: http.StatusUnprocessableEntity, code: CodeValidationFailed, title: "Validation failed"}
+		}
+
+		kind.in, kind.field = field.in, field.field
+
+		if field.in != InBody {
+			kind.status = http.StatusBadRequest
+
+			if kind.code == CodeValidationFailed {
+				kind.code, kind.title = CodeInvalidParameter, "Invalid parameter"
+			}
+		}
+	}
+
+	problem := Problem{Type: problemTypePrefix + kind.code, Title: kind.title, Status: kind.status, Code: kind.code}
+
+	if kind.code == CodeInternalError {
+		return problem
+	}
+
+	problem.Detail = err.Error()
+
+	if kind.field != "" {
+		problem.Errors = []FieldError{{In: kind.in, Field: kind.field, Message: err.Error()}}
+	}
+
+	return problem
+}
+
+// writeProblem writes the problem of the error, internal errors are logged as they are not told to the client.
+func writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	problem := newProblem(err)
+	problem.Instance = r.URL.Path
+
+	if problem.Status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	writeProblemDetails(w, problem)
+}
+
+// writeProblemDetails writes the problem as it is.
+func writeProblemDetails(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", MediaTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// writeJSON writes the value as JSON with the status, it is encoded before anything is written so failures are still reported.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, value any) {
+	var buffer bytes.Buffer
+
+	if err := json.NewEncoder(&buffer).Encode(value); err != nil {
+		writeProblem(w, r, fmt.Errorf("error encoding response: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_, _ = buffer.WriteTo(w)
+}
+
+// decodeBody decodes the JSON body of the request. Syntax errors and bodies which are no object are malformed, fields of the wrong type
+// are attributed to the field and errors of the validating types keep their problem kinds. An optional body can be empty.
+func decodeBody(r *http.Request, value any, optional bool) error {
+	err := json.NewDecoder(r.Body).Decode(value)
+	if err == nil || (optional && errors.Is(err, io.EOF)) {
+		return nil
+	}
+
+	var syntaxError *json.SyntaxError
+
+	// Errors of the decoder are returned as they are, wrapped ones come from types unmarshalling themselves.
+	typeError, isTypeError := err.(*json.UnmarshalTypeError)
+
+	switch {
+	case errors.As(err, &syntaxError), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: %w", ErrMalformedBody, err)
+	case isTypeError && typeError.Field == "":
+		return fmt.Errorf("%w: %w", ErrMalformedBody, err)
+	case isTypeError:
+		return invalidField(InBody, typeError.Field, fmt.Errorf("%s has to be %s", typeError.Field, jsonType(typeError.Type)))
+	case newProblem(err).Code != CodeInternalError:
+		return err
+	}
+
+	return invalidField(InBody, "", err)
+}
+
+// jsonType names the JSON type values of the Go type are decoded from.
+func jsonType(t reflect.Type) string {
+	if reflect.PointerTo(t).Implements(reflect.TypeFor[encoding.TextUnmarshaler]()) {
+		return "a string"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Bool:
+		return "a boolean"
+	default:
+		return "a number"
+	}
+}
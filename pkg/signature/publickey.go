@@ -0,0 +1,140 @@
+package signature
+
+// publickey.go implements the HTTP handlers exporting public keys of devices in standard formats, so verifiers need no knowledge of how keys are stored.
+// A single key is served as JWK, SubjectPublicKeyInfo PEM or DER depending on the Accept header, the keys of all active devices as JWK set.
+// Key IDs are JWK thumbprints, they stay the same for a key as long as it exists.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+)
+
+// Media types public keys are served as.
+const (
+	MediaTypeJWK    = "application/jwk+json"
+	MediaTypeJWKSet = "application/jwk-set+json"
+	MediaTypePEM    = "application/x-pem-file"
+	MediaTypeDER    = "application/octet-stream"
+)
+
+// PublicKey serves the current public key of the device as JWK, SubjectPublicKeyInfo PEM or DER, whichever the Accept header lists first.
+// Without an Accept header the key is served as JWK.
+func (h *Handler) PublicKey(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+
+	mediaType, acceptable := negotiatePublicKey(r.Header.Get("Accept"))
+	if !acceptable {
+		writeProblem(w, r, fmt.Errorf("%w, expected one of: %s, %s, %s", ErrNotAcceptable, MediaTypeJWK, MediaTypePEM, MediaTypeDER))
+		return
+	}
+
+	device, err := h.storage.FindDevice(r.Context(), key)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	public, err := cryptic.ParsePublicKey(device.PublicKey)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	var body []byte
+
+	switch mediaType {
+	case MediaTypePEM:
+		body, err = cryptic.MarshalSPKIPEM(public)
+	case MediaTypeDER:
+		body, err = cryptic.MarshalSPKI(public)
+	default:
+		var jwk cryptic.JWK
+
+		if jwk, err = deviceJWK(device); err == nil {
+			body, err = json.Marshal(jwk)
+		}
+	}
+
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	_, _ = w.Write(body)
+}
+
+// JWKS serves the current public keys of all active devices as JWK set, suspended and decommissioned devices do not sign.
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	set := cryptic.JWKSet{Keys: []cryptic.JWK{}}
+
+	err := h.eachDevice(r, ListDevicesInput{Status: StatusActive}, func(device Device) error {
+		jwk, err := deviceJWK(device)
+		set.Keys = append(set.Keys, jwk)
+
+		return err
+	})
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	body, err := json.Marshal(set)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", MediaTypeJWKSet)
+	_, _ = w.Write(body)
+}
+
+// deviceJWK builds the JWK of the current device key, with the JWS algorithm when its signatures match one.
+func deviceJWK(device Device) (cryptic.JWK, error) {
+	public, err := cryptic.ParsePublicKey(device.PublicKey)
+	if err != nil {
+		return cryptic.JWK{}, err
+	}
+
+	jwk, err := cryptic.NewJWK(public)
+	if err != nil {
+		return cryptic.JWK{}, err
+	}
+
+	jwk.Use = "sig"
+	jwk.Alg = cryptic.JWSAlgorithm(public, device.signatureOptions())
+
+	return jwk, nil
+}
+
+// negotiatePublicKey returns the first media type of the Accept header a public key can be served as, quality values are not weighed.
+func negotiatePublicKey(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return MediaTypeJWK, true
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case MediaTypeJWK, "application/json", "application/*", "*/*":
+			return MediaTypeJWK, true
+		case MediaTypePEM:
+			return MediaTypePEM, true
+		case MediaTypeDER:
+			return MediaTypeDER, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,134 @@
+package signature
+
+// responses.go defines the representations of domain types returned by the HTTP handlers.
+// Domain types carry secrets such as private keys, responses are built field by field so only public material is ever exposed.
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeviceResponse represents a signature device as seen by API clients, without its private key.
+type DeviceResponse struct {
+	Key         uuid.UUID `json:"key"`
+	Algorithm   Algorithm `json:"algorithm"`
+	Bits        int       `json:"bits,omitempty"`
+	Curve       string    `json:"curve,omitempty"`
+	Scheme      string    `json:"scheme,omitempty"`
+	Hash        string    `json:"hash,omitempty"`
+	Encoding    string    `json:"encoding,omitempty"`
+	Label       Label     `json:"label"`
+	Counter     int64     `json:"counter"`
+	PublicKey   string    `json:"publicKey"`
+	Certificate string    `json:"certificate,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+
+	Status          DeviceStatus `json:"status"`
+	StatusChangedAt time.Time    `json:"statusChangedAt"`
+	StatusChangedBy Actor        `json:"statusChangedBy,omitempty"`
+
+	RetiredKeys []DeviceKeyResponse `json:"retiredKeys,omitempty"`
+
+	ImportedCounter   int64  `json:"importedCounter,omitempty"`
+	ImportedSignature string `json:"importedSignature,omitempty"`
+}
+
+// DeviceKeyResponse represents a retired public key of a device with the range of counters it signed.
+type DeviceKeyResponse struct {
+	Version     int       `json:"version"`
+	Algorithm   Algorithm `json:"algorithm"`
+	Bits        int       `json:"bits,omitempty"`
+	Curve       string    `json:"curve,omitempty"`
+	Scheme      string    `json:"scheme,omitempty"`
+	Hash        string    `json:"hash,omitempty"`
+	Encoding    string    `json:"encoding,omitempty"`
+	PublicKey   string    `json:"publicKey"`
+	Certificate string    `json:"certificate,omitempty"`
+	From        int64     `json:"from"`
+	To          int64     `json:"to"`
+	RotatedAt   time.Time `json:"rotatedAt"`
+}
+
+// NewDeviceResponse copies public fields of the device into its response.
+func NewDeviceResponse(device Device) DeviceResponse {
+	return DeviceResponse{
+		Key:         device.Key,
+		Algorithm:   device.Algorithm,
+		Bits:        device.Bits,
+		Curve:       device.Curve,
+		Scheme:      device.Scheme,
+		Hash:        device.Hash,
+		Encoding:    device.Encoding,
+		Label:       device.Label,
+		Counter:     device.Counter,
+		PublicKey:   string(device.PublicKey),
+		Certificate: string(device.Certificate),
+		CreatedAt:   device.CreatedAt,
+
+		Status:          device.Status,
+		StatusChangedAt: device.StatusChangedAt,
+		StatusChangedBy: device.StatusChangedBy,
+
+		RetiredKeys: newDeviceKeyResponses(device.RetiredKeys),
+
+		ImportedCounter:   device.ImportedCounter,
+		ImportedSignature: device.ImportedSignature,
+	}
+}
+
+// newDeviceKeyResponses copies retired keys into responses, nil is kept for devices never rotated.
+func newDeviceKeyResponses(keys []DeviceKey) []DeviceKeyResponse {
+	if keys == nil {
+		return nil
+	}
+
+	responses := make([]DeviceKeyResponse, len(keys))
+	for i, key := range keys {
+		responses[i] = DeviceKeyResponse{
+			Version:     key.Version,
+			Algorithm:   key.Algorithm,
+			Bits:        key.Bits,
+			Curve:       key.Curve,
+			Scheme:      key.Scheme,
+			Hash:        key.Hash,
+			Encoding:    key.Encoding,
+			PublicKey:   string(key.PublicKey),
+			Certificate: string(key.Certificate),
+			From:        key.From,
+			To:          key.To,
+			RotatedAt:   key.RotatedAt,
+		}
+	}
+
+	return responses
+}
+
+// NewDeviceResponses copies public fields of every device into responses.
+func NewDeviceResponses(devices []Device) []DeviceResponse {
+	responses := make([]DeviceResponse, len(devices))
+	for i, device := range devices {
+		responses[i] = NewDeviceResponse(device)
+	}
+
+	return responses
+}
+
+// DevicePage represents a page of devices.
+// NextCursor is the opaque position of the next page, it is omitted on the last page.
+type DevicePage struct {
+	Devices    []DeviceResponse `json:"devices"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// TransactionPage represents a page of device transactions ordered by counter.
+// NextCursor is the counter of the first transaction on the next page, it is omitted on the last page.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   *int64        `json:"nextCursor,omitempty"`
+}
+
+// TransactionBatch represents the transactions signed for a batch, in the order of its data items.
+type TransactionBatch struct {
+	Transactions []Transaction `json:"transactions"`
+}
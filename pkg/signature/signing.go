@@ -0,0 +1,332 @@
+package signature
+
+// signing.go implements key generation, transaction signing and verification shared by every storage implementation.
+// Backends only decide how devices and transactions are persisted, the cryptographic part stays in one place.
+// Private keys are kept by a `cryptic.KeyStore`, devices only hold handles of them.
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+)
+
+// lookupAlgorithm finds the algorithm in the `cryptic` registry, the error lists all supported names.
+func lookupAlgorithm(name Algorithm) (cryptic.Algorithm, error) {
+	algorithm, err := cryptic.Lookup(string(name))
+	if err != nil {
+		return cryptic.Algorithm{}, fmt.Errorf("%w, expected one of: %s", ErrInvalidAlgorithm, strings.Join(cryptic.Names(), ", "))
+	}
+
+	return algorithm, nil
+}
+
+// signatureOptions checks the scheme, hash and encoding for the algorithm and fills in its defaults, empty values of devices
+// created before the options existed select the defaults as well.
+func signatureOptions(algorithm cryptic.Algorithm, options cryptic.SignatureOptions) (cryptic.SignatureOptions, error) {
+	if algorithm.Options == nil {
+		if options != (cryptic.SignatureOptions{}) {
+			return cryptic.SignatureOptions{}, fmt.Errorf("%w: %s has no scheme, hash or encoding to choose", cryptic.ErrInvalidSignatureOptions, algorithm.Name)
+		}
+
+		return options, nil
+	}
+
+	return algorithm.Options(options)
+}
+
+// signatureOptions returns the options recorded for the current key of the device.
+func (d Device) signatureOptions() cryptic.SignatureOptions {
+	return cryptic.SignatureOptions{Scheme: d.Scheme, Hash: d.Hash, Encoding: d.Encoding}
+}
+
+// signatureOptions returns the options recorded for the key.
+func (k DeviceKey) signatureOptions() cryptic.SignatureOptions {
+	return cryptic.SignatureOptions{Scheme: k.Scheme, Hash: k.Hash, Encoding: k.Encoding}
+}
+
+// generateDevice creates a new device with a key pair generated by the keystore for the requested algorithm, the key handle is sealed by the keyring.
+// Instead of generating, an external private key is imported or a key kept by the keystore is referenced, devices migrated from another
+// system also continue its signature chain. Every key has to meet the policy, its parameters are recorded on the device.
+// The signature scheme, hash and encoding are chosen once and recorded with the defaults filled in, so they never change under the device.
+// The authority issues the certificate of the key. Creation time is truncated to microseconds, which is the precision every storage can keep.
+func generateDevice(
+	keyStore cryptic.KeyStore, keyring *Keyring, policy cryptic.KeyPolicy, authority *cryptic.CertificateAuthority, input CreateDeviceInput,
+) (Device, error) {
+	algorithm, err := lookupAlgorithm(input.Algorithm)
+	if err != nil {
+		return Device{}, err
+	}
+
+	options, err := signatureOptions(algorithm, cryptic.SignatureOptions{Scheme: input.Scheme, Hash: input.Hash, Encoding: input.Encoding})
+	if err != nil {
+		return Device{}, err
+	}
+
+	if input.PrivateKey != nil && input.KeyHandle != nil {
+		return Device{}, ErrKeyImportConflict
+	}
+
+	if input.Counter < 0 || (input.Counter > 0) != (input.LastSignature != "") {
+		return Device{}, ErrInvalidChain
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(input.LastSignature); err != nil {
+		return Device{}, ErrSignatureNotBase64
+	}
+
+	var handle, public []byte
+
+	switch {
+	case input.PrivateKey != nil:
+		handle, public, err = keyStore.Import(string(input.Algorithm), input.PrivateKey)
+	case input.KeyHandle != nil:
+		handle = input.KeyHandle
+		public, err = keyStore.Resolve(string(input.Algorithm), input.KeyHandle)
+	default:
+		handle, public, err = keyStore.Generate(string(input.Algorithm), cryptic.KeyParams{Bits: input.Bits, Curve: input.Curve})
+	}
+
+	if err != nil {
+		return Device{}, err
+	}
+
+	params, err := checkKey(policy, public)
+	if err != nil {
+		return Device{}, err
+	}
+
+	// Existing keys are taken as they are, parameters given along have to describe them.
+	if (input.Bits != 0 && input.Bits != params.Bits) || (input.Curve != "" && input.Curve != params.Curve) {
+		return Device{}, fmt.Errorf("%w, the key has %d bits and curve %q", cryptic.ErrKeyMismatch, params.Bits, params.Curve)
+	}
+
+	device := Device{
+		Key:               input.Key,
+		Algorithm:         input.Algorithm,
+		Bits:              params.Bits,
+		Curve:             params.Curve,
+		Scheme:            options.Scheme,
+		Hash:              options.Hash,
+		Encoding:          options.Encoding,
+		PublicKey:         public,
+		KeyHandle:         handle,
+		Label:             input.Label,
+		Counter:           input.Counter,
+		CreatedAt:         time.Now().UTC().Truncate(time.Microsecond),
+		Status:            StatusActive,
+		ImportedCounter:   input.Counter,
+		ImportedSignature: input.LastSignature,
+	}
+
+	device.StatusChangedAt = device.CreatedAt
+
+	device.Certificate, err = issueCertificate(authority, device, device.CreatedAt)
+	if err != nil {
+		return Device{}, err
+	}
+
+	return keyring.Seal(device)
+}
+
+// checkKey checks the PEM encoded public key against the policy and returns its parameters.
+func checkKey(policy cryptic.KeyPolicy, public []byte) (cryptic.KeyParams, error) {
+	key, err := cryptic.ParsePublicKey(public)
+	if err != nil {
+		return cryptic.KeyParams{}, err
+	}
+
+	if err := policy.Check(key); err != nil {
+		return cryptic.KeyParams{}, err
+	}
+
+	return cryptic.KeyParamsOf(key), nil
+}
+
+// changeStatus moves the device to the next state, recording who changed it and when.
+func changeStatus(device Device, input ChangeDeviceStatusInput) (Device, error) {
+	if !device.Status.CanChangeTo(input.Status) {
+		return Device{}, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, device.Status, input.Status)
+	}
+
+	device.Status = input.Status
+	device.StatusChangedAt = time.Now().UTC().Truncate(time.Microsecond)
+	device.StatusChangedBy = input.ChangedBy
+
+	return device, nil
+}
+
+// rotateKey replaces the key pair of the device with a new one generated by the keystore for the algorithm, empty keeps the current one.
+// The current public key is retired with the range of counters it signed, the chain simply continues with the last signature made by it.
+// The new key gets its own certificate from the authority, the retired one keeps its certificate which counts as revoked from then on.
+// Decommissioned devices cannot be rotated, suspended ones can, e.g. after their key was compromised.
+func rotateKey(
+	keyStore cryptic.KeyStore, keyring *Keyring, policy cryptic.KeyPolicy, authority *cryptic.CertificateAuthority, device Device, input RotateDeviceKeyInput,
+) (Device, error) {
+	if device.Status == StatusDecommissioned {
+		return Device{}, ErrDeviceDecommissioned
+	}
+
+	algorithm := input.Algorithm
+	requested := cryptic.KeyParams{Bits: input.Bits, Curve: input.Curve}
+	requestedOptions := cryptic.SignatureOptions{Scheme: input.Scheme, Hash: input.Hash, Encoding: input.Encoding}
+
+	if algorithm == "" || algorithm == device.Algorithm {
+		algorithm = device.Algorithm
+
+		if requestedOptions == (cryptic.SignatureOptions{}) {
+			requestedOptions = device.signatureOptions()
+		}
+
+		// Imported keys can have sizes keys are not generated with, their successors get the defaults then.
+		if requested == (cryptic.KeyParams{}) && (slices.Contains(cryptic.RSABits, device.Bits) || slices.Contains(cryptic.Curves, device.Curve)) {
+			requested = cryptic.KeyParams{Bits: device.Bits, Curve: device.Curve}
+		}
+	}
+
+	registered, err := lookupAlgorithm(algorithm)
+	if err != nil {
+		return Device{}, err
+	}
+
+	options, err := signatureOptions(registered, requestedOptions)
+	if err != nil {
+		return Device{}, err
+	}
+
+	handle, public, err := keyStore.Generate(string(algorithm), requested)
+	if err != nil {
+		return Device{}, err
+	}
+
+	params, err := checkKey(policy, public)
+	if err != nil {
+		return Device{}, err
+	}
+
+	retired := device.CurrentKey()
+	retired.To = device.Counter
+	retired.RotatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	// The history is copied, so devices returned earlier never share it with the rotated one.
+	device.RetiredKeys = append(slices.Clone(device.RetiredKeys), retired)
+	device.Algorithm = algorithm
+	device.Bits = params.Bits
+	device.Curve = params.Curve
+	device.Scheme = options.Scheme
+	device.Hash = options.Hash
+	device.Encoding = options.Encoding
+	device.PublicKey = public
+	device.KeyHandle = handle
+
+	device.Certificate, err = issueCertificate(authority, device, retired.RotatedAt)
+	if err != nil {
+		return Device{}, err
+	}
+
+	return keyring.Seal(device)
+}
+
+// securedData builds the string which is signed for a transaction: `<signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>`.
+func securedData(counter int64, data Data, last string) string {
+	return strconv.FormatInt(counter, 10) + "_" + string(data) + "_" + last
+}
+
+// signTransaction signs data with the device private key, chaining it with the base64 encoded last signature of the device.
+// The last signature is ignored for a device without signatures, the base64 encoded device key is used instead.
+// Only active devices can sign, the key handle is decrypted by the keyring just for the keystore to sign.
+// The transaction records the algorithm, scheme, hash and encoding it was signed with, so verifiers know how to check it.
+func signTransaction(keyStore cryptic.KeyStore, keyring *Keyring, device Device, last string, input Data) (Transaction, error) {
+	if device.Status != StatusActive {
+		return Transaction{}, fmt.Errorf("%w, it is %s", ErrDeviceNotActive, device.Status)
+	}
+
+	previous := base64.StdEncoding.EncodeToString([]byte(device.Key.String()))
+	if device.Counter > 0 {
+		previous = last
+	}
+
+	data := securedData(device.Counter, input, previous)
+
+	algorithm, err := lookupAlgorithm(device.Algorithm)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	options, err := signatureOptions(algorithm, device.signatureOptions())
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	handle, err := keyring.Open(device)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	signature, err := keyStore.Sign(string(device.Algorithm), handle, []byte(data), options)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	transaction := Transaction{
+		Counter:    device.Counter,
+		Signature:  base64.StdEncoding.EncodeToString(signature),
+		SignedData: data,
+		Algorithm:  device.Algorithm,
+		Scheme:     options.Scheme,
+		Hash:       options.Hash,
+		Encoding:   options.Encoding,
+	}
+
+	return transaction, nil
+}
+
+// signTransactions signs the data items in order with consecutive counters starting at the device counter, each chained with the one before.
+// Either all items are signed or none, the device is returned with its counter past the last transaction.
+func signTransactions(keyStore cryptic.KeyStore, keyring *Keyring, device Device, last string, items []Data) ([]Transaction, Device, error) {
+	if len(items) == 0 || len(items) > MaxBatchSize {
+		return nil, Device{}, ErrInvalidBatchSize
+	}
+
+	transactions := make([]Transaction, 0, len(items))
+
+	for _, item := range items {
+		transaction, err := signTransaction(keyStore, keyring, device, last, item)
+		if err != nil {
+			return nil, Device{}, err
+		}
+
+		transactions = append(transactions, transaction)
+		last = transaction.Signature
+		device.Counter++
+	}
+
+	return transactions, device, nil
+}
+
+// verifySignature checks the signature of signed data against the device public key valid for the counter the signed data starts with.
+// Signed data without a counter is checked against the current key, with the scheme, hash and encoding recorded for the key.
+func verifySignature(device Device, signedData, signature []byte) error {
+	key := device.CurrentKey()
+
+	prefix, _, _ := strings.Cut(string(signedData), "_")
+	if counter, err := strconv.ParseInt(prefix, 10, 64); err == nil {
+		key = device.KeyAt(counter)
+	}
+
+	algorithm, err := lookupAlgorithm(key.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	options, err := signatureOptions(algorithm, key.signatureOptions())
+	if err != nil {
+		return err
+	}
+
+	return algorithm.Verify(signedData, signature, key.PublicKey, options)
+}
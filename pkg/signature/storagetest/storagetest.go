@@ -0,0 +1,1206 @@
+// Package storagetest provides a conformance test suite for implementations of `signature.Storage`.
+//
+// Every backend plugs into the suite with a single call from its own tests:
+//
+//	func TestMemory_Storage(t *testing.T) {
+//		storagetest.Run(t, func(keyring *signature.Keyring) signature.Storage {
+//			return signature.NewMemory(cryptic.NewSoftwareKeyStore(), keyring, cryptic.DefaultKeyPolicy(), storagetest.Authority(t))
+//		})
+//	}
+package storagetest
+
+// storagetest.go implements the behavioral contract shared by all storages: device uniqueness, not found errors,
+// strictly monotonic counters without gaps, chaining of the last signature, safety under concurrent signing,
+// paging through transactions, import of devices continuing a foreign chain, device certificates, device key rotation and master key rotation.
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Concurrency is the number of transactions signed in parallel against a single device.
+const Concurrency = 200
+
+// masterKeys are fixed, so backends keeping data between test runs can always unwrap data keys of earlier runs.
+var masterKeys = map[string][]byte{
+	"first":  bytes.Repeat([]byte{1}, 32),
+	"second": bytes.Repeat([]byte{2}, 32),
+}
+
+// NewKeyring creates a keyring holding the test master keys "first" and "second", with the current one given by its ID.
+func NewKeyring(t *testing.T, current string) *signature.Keyring {
+	t.Helper()
+
+	keyring, err := signature.NewKeyring(current, masterKeys)
+	require.NoError(t, err)
+
+	return keyring
+}
+
+// authority is generated once, every test storage and handler issues certificates with the same CA.
+var authority = sync.OnceValues(func() (*cryptic.CertificateAuthority, error) {
+	return cryptic.GenerateCertificateAuthority("Storage Test CA", 24*time.Hour)
+})
+
+// Authority returns the test certificate authority, the same for all tests.
+func Authority(t *testing.T) *cryptic.CertificateAuthority {
+	t.Helper()
+
+	authority, err := authority()
+	require.NoError(t, err)
+
+	return authority
+}
+
+// Run runs the full storage contract against storages built by the factory from a keyring.
+// Each subtest receives a fresh storage and only touches devices it created, so the factory may return shared backends.
+// Master key rotation re-wraps every device of the backend, it runs once all other subtests are finished.
+func Run(t *testing.T, factory func(keyring *signature.Keyring) signature.Storage) {
+	t.Helper()
+
+	tests := map[string]func(*testing.T, signature.Storage){
+		"CreateDevice":                            testCreateDevice,
+		"CreateDeviceAlreadyExists":               testCreateDeviceAlreadyExists,
+		"CreateDeviceKeyParams":                   testCreateDeviceKeyParams,
+		"CreateDeviceSignatureOptions":            testCreateDeviceSignatureOptions,
+		"ImportDevice":                            testImportDevice,
+		"ImportDeviceRejected":                    testImportDeviceRejected,
+		"FindDevice":                              testFindDevice,
+		"FindDeviceNotFound":                      testFindDeviceNotFound,
+		"ListDevices":                             testListDevices,
+		"CreateTransaction":                       testCreateTransaction,
+		"CreateTransactionDeviceNotFound":         testCreateTransactionDeviceNotFound,
+		"CreateTransactionCounter":                testCreateTransactionCounter,
+		"CreateTransactionChain":                  testCreateTransactionChain,
+		"CreateTransactionConcurrently":           testCreateTransactionConcurrently,
+		"CreateTransactionDevicesIsolated":        testCreateTransactionDevicesIsolated,
+		"CreateTransactions":                      testCreateTransactions,
+		"CreateTransactionsAllOrNothing":          testCreateTransactionsAllOrNothing,
+		"CreateTransactionsConcurrently":          testCreateTransactionsConcurrently,
+		"CreateTransactionIdempotent":             testCreateTransactionIdempotent,
+		"CreateTransactionIdempotencyKeyExpired":  testCreateTransactionIdempotencyKeyExpired,
+		"CreateTransactionIdempotentConcurrently": testCreateTransactionIdempotentConcurrently,
+		"ListTransactions":                        testListTransactions,
+		"ListTransactionsDeviceNotFound":          testListTransactionsDeviceNotFound,
+		"FindTransaction":                         testFindTransaction,
+		"ChangeDeviceStatus":                      testChangeDeviceStatus,
+		"ChangeDeviceStatusNotFound":              testChangeDeviceStatusNotFound,
+		"CreateTransactionDeviceNotActive":        testCreateTransactionDeviceNotActive,
+		"RotateDeviceKey":                         testRotateDeviceKey,
+		"RotateDeviceKeyNotAllowed":               testRotateDeviceKeyNotAllowed,
+	}
+
+	t.Run("Contract", func(t *testing.T) {
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				test(t, factory(NewKeyring(t, "first")))
+			})
+		}
+	})
+
+	t.Run("RotateMasterKey", func(t *testing.T) {
+		testRotateMasterKey(t, factory(NewKeyring(t, "first")))
+	})
+}
+
+func testCreateDevice(t *testing.T, s signature.Storage) {
+	for _, algorithm := range []signature.Algorithm{signature.ECC, signature.RSA, signature.ED25519} {
+		input := signature.CreateDeviceInput{Key: uuid.New(), Algorithm: algorithm, Label: "device"}
+
+		device, err := s.CreateDevice(context.Background(), input)
+		require.NoError(t, err)
+
+		assert.Equal(t, input.Key, device.Key)
+		assert.Equal(t, input.Algorithm, device.Algorithm)
+		assert.Equal(t, input.Label, device.Label)
+		assert.Equal(t, int64(0), device.Counter)
+		assert.False(t, device.CreatedAt.IsZero())
+		assert.Equal(t, signature.StatusActive, device.Status)
+		assert.NotEmpty(t, device.PublicKey)
+		assert.NotEmpty(t, device.KeyHandle)
+		assert.Empty(t, ListAllTransactions(t, s, device.Key))
+		AssertCertificate(t, device.Key, device.CurrentKey())
+	}
+}
+
+func testCreateDeviceAlreadyExists(t *testing.T, s signature.Storage) {
+	input := signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC, Label: "first"}
+
+	_, err := s.CreateDevice(context.Background(), input)
+	require.NoError(t, err)
+
+	_, err = s.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: input.Key, Algorithm: signature.RSA, Label: "second"})
+	require.ErrorIs(t, err, signature.ErrDeviceAlreadyExists)
+
+	device, err := s.FindDevice(context.Background(), input.Key)
+	require.NoError(t, err)
+	assert.Equal(t, input.Label, device.Label, "existing device must not be overwritten")
+	assert.Equal(t, input.Algorithm, device.Algorithm, "existing device must not be overwritten")
+}
+
+func testCreateDeviceKeyParams(t *testing.T, s signature.Storage) {
+	tests := []struct {
+		algorithm   signature.Algorithm
+		bits        int
+		curve       string
+		expectBits  int
+		expectCurve string
+	}{
+		{signature.RSA, 0, "", 2048, ""},
+		{signature.RSA, 3072, "", 3072, ""},
+		{signature.ECC, 0, "", 0, "P-384"},
+		{signature.ECC, 0, "P-256", 0, "P-256"},
+		{signature.ECC, 0, "P-521", 0, "P-521"},
+		{signature.ED25519, 0, "", 0, ""},
+	}
+
+	for _, test := range tests {
+		input := signature.CreateDeviceInput{Key: uuid.New(), Algorithm: test.algorithm, Bits: test.bits, Curve: test.curve}
+
+		device, err := s.CreateDevice(context.Background(), input)
+		require.NoError(t, err)
+		assert.Equal(t, test.expectBits, device.Bits, "%s device bits", test.algorithm)
+		assert.Equal(t, test.expectCurve, device.Curve, "%s device curve", test.algorithm)
+
+		found, err := s.FindDevice(context.Background(), device.Key)
+		require.NoError(t, err)
+		assert.Equal(t, device.Bits, found.Bits, "bits must be stored")
+		assert.Equal(t, device.Curve, found.Curve, "curve must be stored")
+	}
+
+	for _, input := range []signature.CreateDeviceInput{
+		{Algorithm: signature.RSA, Bits: 1024},
+		{Algorithm: signature.ECC, Curve: "P-224"},
+		{Algorithm: signature.ED25519, Bits: 2048},
+	} {
+		input.Key = uuid.New()
+
+		_, err := s.CreateDevice(context.Background(), input)
+		require.ErrorIs(t, err, cryptic.ErrInvalidKeyParams, "%s with %d bits and curve %q", input.Algorithm, input.Bits, input.Curve)
+	}
+
+	device, err := s.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC, Curve: "P-256"})
+	require.NoError(t, err)
+
+	rotated, err := s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: device.Key})
+	require.NoError(t, err)
+	assert.Equal(t, "P-256", rotated.Curve, "rotation must keep the curve")
+	assert.Equal(t, "P-256", rotated.RetiredKeys[0].Curve, "retired key must keep its curve")
+
+	rotated, err = s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: device.Key, Curve: "P-521"})
+	require.NoError(t, err)
+	assert.Equal(t, "P-521", rotated.Curve)
+}
+
+func testCreateDeviceSignatureOptions(t *testing.T, s signature.Storage) {
+	tests := []struct {
+		algorithm              signature.Algorithm
+		scheme, hash, encoding string
+		expected               cryptic.SignatureOptions
+	}{
+		{signature.RSA, "", "", "", cryptic.SignatureOptions{Scheme: cryptic.SchemePKCS1v15, Hash: cryptic.HashSHA256}},
+		{signature.RSA, cryptic.SchemePSS, cryptic.HashSHA512, "", cryptic.SignatureOptions{Scheme: cryptic.SchemePSS, Hash: cryptic.HashSHA512}},
+		{signature.ECC, "", "", "", cryptic.SignatureOptions{Hash: cryptic.HashSHA256, Encoding: cryptic.EncodingDER}},
+		{signature.ECC, "", cryptic.HashSHA384, cryptic.EncodingP1363, cryptic.SignatureOptions{Hash: cryptic.HashSHA384, Encoding: cryptic.EncodingP1363}},
+		{signature.ECC, "", "", cryptic.EncodingLegacy, cryptic.SignatureOptions{Hash: cryptic.HashSHA256, Encoding: cryptic.EncodingLegacy}},
+		{signature.ED25519, "", "", "", cryptic.SignatureOptions{}},
+	}
+
+	for _, test := range tests {
+		input := signature.CreateDeviceInput{Key: uuid.New(), Algorithm: test.algorithm, Scheme: test.scheme, Hash: test.hash, Encoding: test.encoding}
+
+		device, err := s.CreateDevice(context.Background(), input)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected.Scheme, device.Scheme, "%s device scheme", test.algorithm)
+		assert.Equal(t, test.expected.Hash, device.Hash, "%s device hash", test.algorithm)
+		assert.Equal(t, test.expected.Encoding, device.Encoding, "%s device encoding", test.algorithm)
+
+		found, err := s.FindDevice(context.Background(), device.Key)
+		require.NoError(t, err)
+		assert.Equal(t, device.Scheme, found.Scheme, "scheme must be stored")
+		assert.Equal(t, device.Hash, found.Hash, "hash must be stored")
+		assert.Equal(t, device.Encoding, found.Encoding, "encoding must be stored")
+
+		_, err = s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		require.NoError(t, err)
+
+		algorithm, err := cryptic.Lookup(string(test.algorithm))
+		require.NoError(t, err)
+
+		for _, transaction := range ListAllTransactions(t, s, device.Key) {
+			assert.Equal(t, test.algorithm, transaction.Algorithm, "transaction must report the algorithm")
+			assert.Equal(t, test.expected.Scheme, transaction.Scheme, "transaction must report the scheme")
+			assert.Equal(t, test.expected.Hash, transaction.Hash, "transaction must report the hash")
+			assert.Equal(t, test.expected.Encoding, transaction.Encoding, "transaction must report the encoding")
+
+			signed, err := base64.StdEncoding.DecodeString(transaction.Signature)
+			require.NoError(t, err)
+
+			options := cryptic.SignatureOptions{Scheme: transaction.Scheme, Hash: transaction.Hash, Encoding: transaction.Encoding}
+			require.NoError(t, algorithm.Verify([]byte(transaction.SignedData), signed, device.PublicKey, options), "%s signature must verify as reported", test.algorithm)
+		}
+	}
+
+	for _, input := range []signature.CreateDeviceInput{
+		{Algorithm: signature.RSA, Hash: "MD5"},
+		{Algorithm: signature.ECC, Scheme: cryptic.SchemePSS},
+		{Algorithm: signature.ED25519, Hash: cryptic.HashSHA512},
+		{Algorithm: signature.ECC, Encoding: "PEM"},
+		{Algorithm: signature.RSA, Encoding: cryptic.EncodingDER},
+	} {
+		input.Key = uuid.New()
+
+		_, err := s.CreateDevice(context.Background(), input)
+		require.ErrorIs(t, err, cryptic.ErrInvalidSignatureOptions, "%s with scheme %q and hash %q", input.Algorithm, input.Scheme, input.Hash)
+	}
+
+	device, err := s.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.RSA, Scheme: cryptic.SchemePSS})
+	require.NoError(t, err)
+
+	rotated, err := s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: device.Key})
+	require.NoError(t, err)
+	assert.Equal(t, cryptic.SchemePSS, rotated.Scheme, "rotation must keep the scheme")
+	assert.Equal(t, cryptic.SchemePSS, rotated.RetiredKeys[0].Scheme, "retired key must keep its scheme")
+
+	rotated, err = s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: device.Key, Algorithm: signature.ECC})
+	require.NoError(t, err)
+	assert.Empty(t, rotated.Scheme, "ECDSA keys have no scheme")
+	assert.Equal(t, cryptic.HashSHA256, rotated.Hash)
+	assert.Equal(t, cryptic.EncodingDER, rotated.Encoding)
+
+	// Devices signing with the legacy encoding move off it by rotation, the retired key keeps its encoding for verification.
+	legacy, err := s.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC, Encoding: cryptic.EncodingLegacy})
+	require.NoError(t, err)
+
+	rotated, err = s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: legacy.Key, Encoding: cryptic.EncodingDER})
+	require.NoError(t, err)
+	assert.Equal(t, cryptic.EncodingDER, rotated.Encoding)
+	assert.Equal(t, cryptic.EncodingLegacy, rotated.RetiredKeys[0].Encoding, "retired key must keep its encoding")
+}
+
+func testImportDevice(t *testing.T, s signature.Storage) {
+	_, private, err := cryptic.GenerateECDSAWithMarshal(cryptic.KeyParams{})
+	require.NoError(t, err)
+
+	last := base64.StdEncoding.EncodeToString([]byte("signature of the previous system"))
+	input := signature.CreateDeviceInput{Key: uuid.New(), Algorithm: signature.ECC, Label: "migrated", PrivateKey: private, Counter: 5, LastSignature: last}
+
+	device, err := s.CreateDevice(context.Background(), input)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), device.Counter)
+	assert.Equal(t, int64(5), device.ImportedCounter)
+	assert.Equal(t, last, device.ImportedSignature)
+
+	first, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "first"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), first.Counter)
+	assert.Equal(t, "5_first_"+last, first.SignedData, "first transaction must continue the imported chain")
+
+	second, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "second"})
+	require.NoError(t, err)
+	assert.Equal(t, "6_second_"+first.Signature, second.SignedData)
+
+	algorithm, err := cryptic.Lookup(string(signature.ECC))
+	require.NoError(t, err)
+
+	for _, transaction := range []signature.Transaction{first, second} {
+		signed, err := base64.StdEncoding.DecodeString(transaction.Signature)
+		require.NoError(t, err)
+		err = algorithm.Verify([]byte(transaction.SignedData), signed, device.PublicKey, cryptic.SignatureOptions{})
+		require.NoError(t, err, "imported key must sign transaction %d", transaction.Counter)
+	}
+
+	page, err := s.ListTransactions(context.Background(), signature.ListTransactionsInput{DeviceKey: device.Key, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Transaction{first, second}, page)
+
+	page, err = s.ListTransactions(context.Background(), signature.ListTransactionsInput{DeviceKey: device.Key, From: 6, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Transaction{second}, page)
+
+	transaction, err := s.FindTransaction(context.Background(), device.Key, 6)
+	require.NoError(t, err)
+	assert.Equal(t, second, transaction)
+
+	_, err = s.FindTransaction(context.Background(), device.Key, 4)
+	require.ErrorIs(t, err, signature.ErrTransactionNotFound, "transactions of the previous system are not kept")
+}
+
+func testImportDeviceRejected(t *testing.T, s signature.Storage) {
+	_, private, err := cryptic.GenerateECDSAWithMarshal(cryptic.KeyParams{})
+	require.NoError(t, err)
+
+	last := base64.StdEncoding.EncodeToString([]byte("signature"))
+
+	tests := map[string]struct {
+		input    signature.CreateDeviceInput
+		expected error
+	}{
+		"Key of another algorithm":  {signature.CreateDeviceInput{Algorithm: signature.RSA, PrivateKey: private}, cryptic.ErrKeyMismatch},
+		"Malformed key":             {signature.CreateDeviceInput{Algorithm: signature.ECC, PrivateKey: []byte("not a key")}, cryptic.ErrInvalidPrivateKey},
+		"Key and handle":            {signature.CreateDeviceInput{Algorithm: signature.ECC, PrivateKey: private, KeyHandle: []byte("handle")}, signature.ErrKeyImportConflict},
+		"Negative counter":          {signature.CreateDeviceInput{Algorithm: signature.ECC, PrivateKey: private, Counter: -1}, signature.ErrInvalidChain},
+		"Counter without signature": {signature.CreateDeviceInput{Algorithm: signature.ECC, PrivateKey: private, Counter: 5}, signature.ErrInvalidChain},
+		"Signature without counter": {signature.CreateDeviceInput{Algorithm: signature.ECC, PrivateKey: private, LastSignature: last}, signature.ErrInvalidChain},
+		"Signature not base64":      {signature.CreateDeviceInput{Algorithm: signature.ECC, PrivateKey: private, Counter: 5, LastSignature: "%%%"}, signature.ErrSignatureNotBase64},
+	}
+
+	for name, test := range tests {
+		test.input.Key = uuid.New()
+
+		_, err := s.CreateDevice(context.Background(), test.input)
+		require.ErrorIs(t, err, test.expected, name)
+
+		_, err = s.FindDevice(context.Background(), test.input.Key)
+		require.ErrorIs(t, err, signature.ErrDeviceNotFound, "%s must not create the device", name)
+	}
+}
+
+func testFindDevice(t *testing.T, s signature.Storage) {
+	created := createDevice(t, s, signature.RSA)
+
+	device, err := s.FindDevice(context.Background(), created.Key)
+	require.NoError(t, err)
+
+	assert.Equal(t, created.Key, device.Key)
+	assert.Equal(t, created.Algorithm, device.Algorithm)
+	assert.Equal(t, created.Label, device.Label)
+	assert.Equal(t, created.PublicKey, device.PublicKey)
+	assert.Equal(t, created.Counter, device.Counter)
+	assert.Equal(t, created.CreatedAt, device.CreatedAt)
+	assert.Equal(t, created.Certificate, device.Certificate)
+}
+
+func testFindDeviceNotFound(t *testing.T, s signature.Storage) {
+	_, err := s.FindDevice(context.Background(), uuid.New())
+	require.ErrorIs(t, err, signature.ErrDeviceNotFound)
+}
+
+func testListDevices(t *testing.T, s signature.Storage) {
+	// Devices are tagged with a unique label, so devices of other tests sharing the storage are filtered out.
+	tag := uuid.NewString()
+
+	inputs := []struct {
+		algorithm    signature.Algorithm
+		label        string
+		transactions int
+	}{
+		{signature.ECC, "b-" + tag, 2},
+		{signature.RSA, "a-" + tag, 0},
+		{signature.ECC, "c-" + tag, 1},
+	}
+
+	devices := make([]signature.Device, len(inputs))
+
+	for i, input := range inputs {
+		device, err := s.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: input.algorithm, Label: signature.Label(input.label)})
+		require.NoError(t, err)
+
+		for range input.transactions {
+			_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+			require.NoError(t, err)
+		}
+
+		devices[i], err = s.FindDevice(context.Background(), device.Key)
+		require.NoError(t, err)
+	}
+
+	// The last device is suspended, so devices can be filtered by status.
+	_, err := s.ChangeDeviceStatus(context.Background(), signature.ChangeDeviceStatusInput{Key: devices[2].Key, Status: signature.StatusSuspended, ChangedBy: "test"})
+	require.NoError(t, err)
+
+	devices[2], err = s.FindDevice(context.Background(), devices[2].Key)
+	require.NoError(t, err)
+
+	byCreatedAt := slices.Clone(devices)
+	slices.SortFunc(byCreatedAt, func(a, b signature.Device) int {
+		if order := a.CreatedAt.Compare(b.CreatedAt); order != 0 {
+			return order
+		}
+
+		return bytes.Compare(a.Key[:], b.Key[:])
+	})
+
+	tests := []struct {
+		name     string
+		input    signature.ListDevicesInput
+		expected []signature.Device
+	}{
+		{"created at", signature.ListDevicesInput{Label: tag, Sort: signature.SortByCreatedAt}, byCreatedAt},
+		{"created at descending", signature.ListDevicesInput{Label: tag, Sort: signature.SortByCreatedAt, Descending: true}, reversed(byCreatedAt)},
+		{"label", signature.ListDevicesInput{Label: tag, Sort: signature.SortByLabel}, []signature.Device{devices[1], devices[0], devices[2]}},
+		{"label descending", signature.ListDevicesInput{Label: tag, Sort: signature.SortByLabel, Descending: true}, []signature.Device{devices[2], devices[0], devices[1]}},
+		{"counter", signature.ListDevicesInput{Label: tag, Sort: signature.SortByCounter}, []signature.Device{devices[1], devices[2], devices[0]}},
+		{"label case insensitive", signature.ListDevicesInput{Label: "B-" + strings.ToUpper(tag), Sort: signature.SortByLabel}, devices[:1]},
+		{"label wildcards matched literally", signature.ListDevicesInput{Label: "%" + tag}, []signature.Device{}},
+		{"algorithm", signature.ListDevicesInput{Label: tag, Algorithm: signature.ECC, Sort: signature.SortByLabel}, []signature.Device{devices[0], devices[2]}},
+		{"limit", signature.ListDevicesInput{Label: tag, Sort: signature.SortByLabel, Limit: 2}, []signature.Device{devices[1], devices[0]}},
+		{"status", signature.ListDevicesInput{Label: tag, Status: signature.StatusActive, Sort: signature.SortByLabel}, []signature.Device{devices[1], devices[0]}},
+		{"status suspended", signature.ListDevicesInput{Label: tag, Status: signature.StatusSuspended}, devices[2:]},
+	}
+
+	for _, test := range tests {
+		if test.input.Limit == 0 {
+			test.input.Limit = signature.MaxLimit
+		}
+
+		page, err := s.ListDevices(context.Background(), test.input)
+		require.NoError(t, err)
+		assertDevices(t, test.expected, page, test.name)
+	}
+
+	for _, sort := range []signature.DeviceSort{signature.SortByCreatedAt, signature.SortByLabel, signature.SortByCounter} {
+		for _, descending := range []bool{false, true} {
+			input := signature.ListDevicesInput{Label: tag, Sort: sort, Descending: descending, Limit: signature.MaxLimit}
+
+			all, err := s.ListDevices(context.Background(), input)
+			require.NoError(t, err)
+
+			// Paging one device at a time with cursors has to visit the same devices in the same order.
+			paged := []signature.Device{}
+			input.Limit = 1
+
+			for {
+				page, err := s.ListDevices(context.Background(), input)
+				require.NoError(t, err)
+
+				if len(page) == 0 {
+					break
+				}
+
+				paged = append(paged, page...)
+
+				cursor := signature.NewDeviceCursor(page[len(page)-1])
+				input.After = &cursor
+			}
+
+			assertDevices(t, all, paged, fmt.Sprintf("paging by %s descending %t", sort, descending))
+		}
+	}
+}
+
+func testCreateTransaction(t *testing.T, s signature.Storage) {
+	for _, algorithm := range []signature.Algorithm{signature.ECC, signature.RSA, signature.ED25519} {
+		device := createDevice(t, s, algorithm)
+
+		transaction, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, transaction.Signature)
+		assert.Equal(t, "0_data_"+base64.StdEncoding.EncodeToString([]byte(device.Key.String())), transaction.SignedData)
+
+		assert.Equal(t, int64(0), transaction.Counter)
+
+		device, err = s.FindDevice(context.Background(), device.Key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), device.Counter)
+		assert.Equal(t, []signature.Transaction{transaction}, ListAllTransactions(t, s, device.Key))
+	}
+}
+
+func testCreateTransactionDeviceNotFound(t *testing.T, s signature.Storage) {
+	_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: uuid.New(), Data: "data"})
+	require.ErrorIs(t, err, signature.ErrDeviceNotFound)
+}
+
+func testCreateTransactionCounter(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	for i := range 10 {
+		_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		require.NoError(t, err)
+
+		device, err = s.FindDevice(context.Background(), device.Key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(i+1), device.Counter)
+	}
+
+	AssertChain(t, device, ListAllTransactions(t, s, device.Key))
+}
+
+func testCreateTransactionChain(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.RSA)
+
+	transactions := make([]signature.Transaction, 3)
+
+	for i := range transactions {
+		transaction, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		require.NoError(t, err)
+
+		transactions[i] = transaction
+	}
+
+	assert.Equal(t, "0_data_"+base64.StdEncoding.EncodeToString([]byte(device.Key.String())), transactions[0].SignedData,
+		"first transaction must be chained with the base64 encoded device key")
+
+	for i := 1; i < len(transactions); i++ {
+		assert.Equal(t, strconv.Itoa(i)+"_data_"+transactions[i-1].Signature, transactions[i].SignedData,
+			"transaction %d must be chained with the signature of transaction %d", i, i-1)
+	}
+
+	assert.Equal(t, transactions, ListAllTransactions(t, s, device.Key))
+}
+
+func testCreateTransactions(t *testing.T, s signature.Storage) {
+	for _, algorithm := range []signature.Algorithm{signature.ECC, signature.RSA, signature.ED25519} {
+		device := createDevice(t, s, algorithm)
+
+		single, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "single"})
+		require.NoError(t, err)
+
+		batch, err := s.CreateTransactions(context.Background(), signature.CreateTransactionsInput{DeviceKey: device.Key, Data: []signature.Data{"first", "second", "third"}})
+		require.NoError(t, err)
+		require.Len(t, batch, 3)
+
+		for i, data := range []string{"first", "second", "third"} {
+			assert.Equal(t, int64(i+1), batch[i].Counter)
+			assert.True(t, strings.HasPrefix(batch[i].SignedData, strconv.Itoa(i+1)+"_"+data+"_"), "items are signed in order")
+		}
+
+		assert.True(t, strings.HasSuffix(batch[0].SignedData, "_"+single.Signature), "batches continue the chain")
+
+		device, err = s.FindDevice(context.Background(), device.Key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), device.Counter)
+
+		transactions := ListAllTransactions(t, s, device.Key)
+		assert.Equal(t, batch, transactions[1:])
+		AssertChain(t, device, transactions)
+	}
+}
+
+func testCreateTransactionsAllOrNothing(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	_, err := s.CreateTransactions(context.Background(), signature.CreateTransactionsInput{DeviceKey: uuid.New(), Data: []signature.Data{"data"}})
+	require.ErrorIs(t, err, signature.ErrDeviceNotFound)
+
+	for _, size := range []int{0, signature.MaxBatchSize + 1} {
+		_, err = s.CreateTransactions(context.Background(), signature.CreateTransactionsInput{DeviceKey: device.Key, Data: make([]signature.Data, size)})
+		require.ErrorIs(t, err, signature.ErrInvalidBatchSize, size)
+	}
+
+	_, err = s.ChangeDeviceStatus(context.Background(), signature.ChangeDeviceStatusInput{Key: device.Key, Status: signature.StatusSuspended, ChangedBy: "actor"})
+	require.NoError(t, err)
+
+	_, err = s.CreateTransactions(context.Background(), signature.CreateTransactionsInput{DeviceKey: device.Key, Data: []signature.Data{"first", "second"}})
+	require.ErrorIs(t, err, signature.ErrDeviceNotActive)
+
+	device, err = s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), device.Counter)
+	assert.Empty(t, ListAllTransactions(t, s, device.Key))
+}
+
+func testCreateTransactionsConcurrently(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ED25519)
+
+	var wg sync.WaitGroup
+
+	start := make(chan struct{})
+
+	for i := range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			if i%2 == 0 {
+				_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "single"})
+				assert.NoError(t, err)
+
+				return
+			}
+
+			batch, err := s.CreateTransactions(context.Background(), signature.CreateTransactionsInput{DeviceKey: device.Key, Data: []signature.Data{"a", "b", "c"}})
+			if assert.NoError(t, err) {
+				assert.Equal(t, batch[0].Counter+2, batch[2].Counter, "counters of a batch are consecutive")
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	device, err := s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), device.Counter)
+	AssertChain(t, device, ListAllTransactions(t, s, device.Key))
+}
+
+func testCreateTransactionIdempotent(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+	other := createDevice(t, s, signature.ECC)
+
+	// Keys are global, every run gets keys of its own as backends keep them between runs.
+	retry, another, unused := "retry-"+uuid.NewString(), "another-"+uuid.NewString(), "new-"+uuid.NewString()
+
+	sign := func(key uuid.UUID, idempotencyKey string, data signature.Data) (signature.Transaction, error) {
+		input := signature.CreateTransactionInput{DeviceKey: key, Data: data, IdempotencyKey: idempotencyKey, IdempotencyWindow: time.Hour}
+		return s.CreateTransaction(context.Background(), input)
+	}
+
+	first, err := sign(device.Key, retry, "data")
+	require.NoError(t, err)
+
+	retried, err := sign(device.Key, retry, "data")
+	require.NoError(t, err)
+	assert.Equal(t, first, retried, "retries return the transaction signed first")
+
+	_, err = sign(device.Key, retry, "other data")
+	require.ErrorIs(t, err, signature.ErrIdempotencyKeyConflict)
+
+	// A key reused with another device conflicts, whatever the data, and signs nothing for that device.
+	_, err = sign(other.Key, retry, "data")
+	require.ErrorIs(t, err, signature.ErrIdempotencyKeyConflict)
+
+	_, err = sign(other.Key, retry, "other data")
+	require.ErrorIs(t, err, signature.ErrIdempotencyKeyConflict)
+
+	found, err := s.FindDevice(context.Background(), other.Key)
+	require.NoError(t, err)
+	assert.Zero(t, found.Counter)
+
+	second, err := sign(device.Key, another, "data")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), second.Counter)
+
+	// Without a key every request is signed.
+	third, err := sign(device.Key, "", "data")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), third.Counter)
+
+	// Transactions signed before the device was suspended are still returned to retries.
+	_, err = s.ChangeDeviceStatus(context.Background(), signature.ChangeDeviceStatusInput{Key: device.Key, Status: signature.StatusSuspended, ChangedBy: "actor"})
+	require.NoError(t, err)
+
+	retried, err = sign(device.Key, retry, "data")
+	require.NoError(t, err)
+	assert.Equal(t, first, retried)
+
+	_, err = sign(device.Key, unused, "data")
+	require.ErrorIs(t, err, signature.ErrDeviceNotActive)
+
+	found, err = s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), found.Counter, "retries never burn a counter")
+}
+
+func testCreateTransactionIdempotencyKeyExpired(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+	input := signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data", IdempotencyKey: "retry-" + uuid.NewString(), IdempotencyWindow: time.Millisecond}
+
+	first, err := s.CreateTransaction(context.Background(), input)
+	require.NoError(t, err)
+
+	time.Sleep(2 * input.IdempotencyWindow)
+
+	// Expired keys can be used again, even with other data.
+	input.Data = "other data"
+
+	second, err := s.CreateTransaction(context.Background(), input)
+	require.NoError(t, err)
+	assert.Equal(t, first.Counter+1, second.Counter)
+
+	device, err = s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	AssertChain(t, device, ListAllTransactions(t, s, device.Key))
+}
+
+func testCreateTransactionIdempotentConcurrently(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ED25519)
+	input := signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data", IdempotencyKey: "retry-" + uuid.NewString(), IdempotencyWindow: time.Hour}
+
+	var wg sync.WaitGroup
+
+	start := make(chan struct{})
+	transactions := make([]signature.Transaction, 10)
+
+	for i := range transactions {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			transaction, err := s.CreateTransaction(context.Background(), input)
+			assert.NoError(t, err)
+
+			transactions[i] = transaction
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	for _, transaction := range transactions {
+		assert.Equal(t, transactions[0], transaction, "concurrent retries are signed once")
+	}
+
+	found, err := s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), found.Counter)
+}
+
+func testCreateTransactionConcurrently(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	var wg sync.WaitGroup
+
+	// All signers are released at once to maximize contention on the device.
+	start := make(chan struct{})
+	errs := make(chan error, Concurrency)
+
+	for range Concurrency {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+			errs <- err
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	device, err := s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(Concurrency), device.Counter)
+
+	AssertChain(t, device, ListAllTransactions(t, s, device.Key))
+}
+
+func testCreateTransactionDevicesIsolated(t *testing.T, s signature.Storage) {
+	first := createDevice(t, s, signature.ECC)
+	second := createDevice(t, s, signature.ECC)
+
+	for range 3 {
+		_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: first.Key, Data: "data"})
+		require.NoError(t, err)
+	}
+
+	second, err := s.FindDevice(context.Background(), second.Key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), second.Counter)
+	assert.Empty(t, ListAllTransactions(t, s, second.Key))
+}
+
+func testListTransactions(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ED25519)
+
+	transactions := make([]signature.Transaction, 5)
+
+	for i := range transactions {
+		transaction, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		require.NoError(t, err)
+
+		transactions[i] = transaction
+	}
+
+	tests := []struct {
+		from, limit int
+		expected    []signature.Transaction
+	}{
+		{0, 5, transactions},
+		{0, 10, transactions},
+		{0, 2, transactions[:2]},
+		{2, 2, transactions[2:4]},
+		{4, 2, transactions[4:]},
+		{5, 2, []signature.Transaction{}},
+		{100, 2, []signature.Transaction{}},
+	}
+
+	for _, test := range tests {
+		page, err := s.ListTransactions(context.Background(), signature.ListTransactionsInput{DeviceKey: device.Key, From: int64(test.from), Limit: test.limit})
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, page, "from %d limit %d", test.from, test.limit)
+	}
+}
+
+func testListTransactionsDeviceNotFound(t *testing.T, s signature.Storage) {
+	_, err := s.ListTransactions(context.Background(), signature.ListTransactionsInput{DeviceKey: uuid.New(), Limit: 1})
+	require.ErrorIs(t, err, signature.ErrDeviceNotFound)
+}
+
+func testFindTransaction(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	first, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "first"})
+	require.NoError(t, err)
+
+	second, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "second"})
+	require.NoError(t, err)
+
+	transaction, err := s.FindTransaction(context.Background(), device.Key, 0)
+	require.NoError(t, err)
+	assert.Equal(t, first, transaction)
+
+	transaction, err = s.FindTransaction(context.Background(), device.Key, 1)
+	require.NoError(t, err)
+	assert.Equal(t, second, transaction)
+
+	_, err = s.FindTransaction(context.Background(), device.Key, 2)
+	require.ErrorIs(t, err, signature.ErrTransactionNotFound)
+
+	_, err = s.FindTransaction(context.Background(), uuid.New(), 0)
+	require.ErrorIs(t, err, signature.ErrDeviceNotFound)
+}
+
+func testChangeDeviceStatus(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	steps := []struct {
+		status signature.DeviceStatus
+		err    error
+	}{
+		{signature.StatusActive, signature.ErrInvalidTransition},
+		{signature.StatusSuspended, nil},
+		{signature.StatusSuspended, signature.ErrInvalidTransition},
+		{signature.StatusActive, nil},
+		{signature.StatusDecommissioned, nil},
+		{signature.StatusActive, signature.ErrInvalidTransition},
+		{signature.StatusSuspended, signature.ErrInvalidTransition},
+	}
+
+	for i, step := range steps {
+		actor := signature.Actor(fmt.Sprintf("actor-%d", i))
+
+		changed, err := s.ChangeDeviceStatus(context.Background(), signature.ChangeDeviceStatusInput{Key: device.Key, Status: step.status, ChangedBy: actor})
+		if step.err != nil {
+			require.ErrorIs(t, err, step.err, "step %d", i)
+			continue
+		}
+
+		require.NoError(t, err, "step %d", i)
+		assert.Equal(t, step.status, changed.Status)
+		assert.Equal(t, actor, changed.StatusChangedBy)
+		assert.False(t, changed.StatusChangedAt.Before(device.StatusChangedAt))
+
+		found, err := s.FindDevice(context.Background(), device.Key)
+		require.NoError(t, err)
+		assert.Equal(t, changed.Status, found.Status)
+		assert.Equal(t, changed.StatusChangedBy, found.StatusChangedBy)
+		assert.Equal(t, changed.StatusChangedAt, found.StatusChangedAt)
+
+		device = changed
+	}
+}
+
+func testChangeDeviceStatusNotFound(t *testing.T, s signature.Storage) {
+	_, err := s.ChangeDeviceStatus(context.Background(), signature.ChangeDeviceStatusInput{Key: uuid.New(), Status: signature.StatusSuspended, ChangedBy: "actor"})
+	require.ErrorIs(t, err, signature.ErrDeviceNotFound)
+}
+
+func testCreateTransactionDeviceNotActive(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	sign := func() error {
+		_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		return err
+	}
+
+	change := func(status signature.DeviceStatus) {
+		_, err := s.ChangeDeviceStatus(context.Background(), signature.ChangeDeviceStatusInput{Key: device.Key, Status: status, ChangedBy: "actor"})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, sign())
+
+	change(signature.StatusSuspended)
+	require.ErrorIs(t, sign(), signature.ErrDeviceNotActive)
+
+	change(signature.StatusActive)
+	require.NoError(t, sign())
+
+	change(signature.StatusDecommissioned)
+	require.ErrorIs(t, sign(), signature.ErrDeviceNotActive)
+
+	// Refused signatures do not burn counter values and the chain stays readable.
+	device, err := s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), device.Counter)
+
+	AssertChain(t, device, ListAllTransactions(t, s, device.Key))
+}
+
+func testRotateDeviceKey(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	sign := func(n int) {
+		for range n {
+			_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+			require.NoError(t, err)
+		}
+	}
+
+	rotate := func(algorithm signature.Algorithm) signature.Device {
+		rotated, err := s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: device.Key, Algorithm: algorithm})
+		require.NoError(t, err)
+
+		return rotated
+	}
+
+	sign(2)
+	rotate(signature.RSA)
+	sign(1)
+	// A key rotated before signing anything keeps an empty range.
+	rotate("")
+	rotated := rotate("")
+	sign(2)
+
+	found, err := s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, signature.RSA, found.Algorithm)
+	assert.Equal(t, rotated.PublicKey, found.PublicKey)
+	assert.Equal(t, int64(5), found.Counter)
+
+	require.Len(t, found.RetiredKeys, 3)
+
+	for i, expected := range []struct {
+		algorithm signature.Algorithm
+		from, to  int64
+	}{
+		{signature.ECC, 0, 2},
+		{signature.RSA, 2, 3},
+		{signature.RSA, 3, 3},
+	} {
+		key := found.RetiredKeys[i]
+		assert.Equal(t, i+1, key.Version, "key %d", i)
+		assert.Equal(t, expected.algorithm, key.Algorithm, "key %d", i)
+		assert.Equal(t, expected.from, key.From, "key %d", i)
+		assert.Equal(t, expected.to, key.To, "key %d", i)
+		assert.False(t, key.RotatedAt.IsZero(), "key %d", i)
+	}
+
+	assert.Equal(t, device.PublicKey, found.RetiredKeys[0].PublicKey)
+	assert.Equal(t, 4, found.CurrentKey().Version)
+	assert.Equal(t, int64(3), found.CurrentKey().From)
+
+	// Every key keeps the certificate issued for it.
+	assert.Equal(t, device.Certificate, found.RetiredKeys[0].Certificate)
+	assert.Equal(t, rotated.Certificate, found.Certificate)
+
+	for _, key := range append(found.RetiredKeys, found.CurrentKey()) {
+		AssertCertificate(t, device.Key, key)
+	}
+
+	// The chain continues across keys and every signature verifies with the key valid for its counter.
+	transactions := ListAllTransactions(t, s, device.Key)
+	AssertChain(t, found, transactions)
+
+	for _, transaction := range transactions {
+		key := found.KeyAt(transaction.Counter)
+
+		algorithm, err := cryptic.Lookup(string(key.Algorithm))
+		require.NoError(t, err)
+
+		signed, err := base64.StdEncoding.DecodeString(transaction.Signature)
+		require.NoError(t, err)
+		assert.NoError(t, algorithm.Verify([]byte(transaction.SignedData), signed, key.PublicKey, cryptic.SignatureOptions{}), "transaction %d", transaction.Counter)
+	}
+}
+
+func testRotateDeviceKeyNotAllowed(t *testing.T, s signature.Storage) {
+	_, err := s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: uuid.New()})
+	require.ErrorIs(t, err, signature.ErrDeviceNotFound)
+
+	device := createDevice(t, s, signature.ECC)
+
+	change := func(status signature.DeviceStatus) {
+		_, err := s.ChangeDeviceStatus(context.Background(), signature.ChangeDeviceStatusInput{Key: device.Key, Status: status, ChangedBy: "actor"})
+		require.NoError(t, err)
+	}
+
+	// Suspended devices can be rotated, e.g. after their key was compromised.
+	change(signature.StatusSuspended)
+
+	_, err = s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: device.Key})
+	require.NoError(t, err)
+
+	change(signature.StatusDecommissioned)
+
+	_, err = s.RotateDeviceKey(context.Background(), signature.RotateDeviceKeyInput{Key: device.Key})
+	require.ErrorIs(t, err, signature.ErrDeviceDecommissioned)
+
+	found, err := s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Len(t, found.RetiredKeys, 1)
+}
+
+func testRotateMasterKey(t *testing.T, s signature.Storage) {
+	device := createDevice(t, s, signature.ECC)
+
+	sign := func() {
+		_, err := s.CreateTransaction(context.Background(), signature.CreateTransactionInput{DeviceKey: device.Key, Data: "data"})
+		require.NoError(t, err)
+	}
+
+	sign()
+
+	rewrapped, err := s.RotateMasterKey(context.Background(), NewKeyring(t, "second"))
+	require.NoError(t, err)
+	assert.Positive(t, rewrapped)
+
+	sign()
+
+	// A keyring without the master keys in use is refused and the storage keeps the previous one.
+	unknown, err := signature.NewKeyring("third", map[string][]byte{"third": bytes.Repeat([]byte{3}, 32)})
+	require.NoError(t, err)
+
+	_, err = s.RotateMasterKey(context.Background(), unknown)
+	require.ErrorIs(t, err, signature.ErrMasterKeyNotFound)
+
+	sign()
+
+	_, err = s.RotateMasterKey(context.Background(), NewKeyring(t, "first"))
+	require.NoError(t, err)
+
+	rewrapped, err = s.RotateMasterKey(context.Background(), NewKeyring(t, "first"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, rewrapped)
+
+	sign()
+
+	// Rotation never changes the key pair, so the whole chain verifies against the original public key.
+	found, err := s.FindDevice(context.Background(), device.Key)
+	require.NoError(t, err)
+	assert.Equal(t, device.PublicKey, found.PublicKey)
+	assert.Equal(t, int64(4), found.Counter)
+
+	transactions := ListAllTransactions(t, s, device.Key)
+	AssertChain(t, found, transactions)
+
+	algorithm, err := cryptic.Lookup(string(device.Algorithm))
+	require.NoError(t, err)
+
+	for _, transaction := range transactions {
+		signature, err := base64.StdEncoding.DecodeString(transaction.Signature)
+		require.NoError(t, err)
+		assert.NoError(t, algorithm.Verify([]byte(transaction.SignedData), signature, device.PublicKey, cryptic.SignatureOptions{}), "transaction %d", transaction.Counter)
+	}
+}
+
+// ListAllTransactions pages through all transactions of the device.
+func ListAllTransactions(t *testing.T, s signature.Storage, key uuid.UUID) []signature.Transaction {
+	t.Helper()
+
+	const limit = 50
+
+	transactions := []signature.Transaction{}
+
+	for {
+		page, err := s.ListTransactions(context.Background(), signature.ListTransactionsInput{DeviceKey: key, From: int64(len(transactions)), Limit: limit})
+		require.NoError(t, err)
+
+		transactions = append(transactions, page...)
+
+		if len(page) < limit {
+			return transactions
+		}
+	}
+}
+
+// AssertChain asserts that the device has exactly Counter transactions, numbered from 0 without gaps or duplicates,
+// each one with base64 encoded signature and signed data `<counter>_<data>_<previous>`, where previous is the signature
+// of its predecessor (or the base64 encoded device key for the first one).
+func AssertChain(t *testing.T, device signature.Device, transactions []signature.Transaction) {
+	t.Helper()
+
+	require.Len(t, transactions, int(device.Counter), "every counter value must have exactly one transaction")
+
+	previous := base64.StdEncoding.EncodeToString([]byte(device.Key.String()))
+
+	for i, transaction := range transactions {
+		assert.Equal(t, int64(i), transaction.Counter, "transaction %d has unexpected counter", i)
+		assert.True(t, strings.HasPrefix(transaction.SignedData, strconv.Itoa(i)+"_"),
+			"transaction %d has signed data %q with unexpected counter", i, transaction.SignedData)
+		assert.True(t, strings.HasSuffix(transaction.SignedData, "_"+previous),
+			"transaction %d is not chained with the previous signature", i)
+
+		_, err := base64.StdEncoding.DecodeString(transaction.Signature)
+		assert.NoError(t, err, "transaction %d signature is not base64 encoded", i)
+
+		previous = transaction.Signature
+	}
+}
+
+// AssertCertificate asserts that the device key has a certificate for its public key naming the device by its key,
+// issued by the test certificate authority of Authority.
+func AssertCertificate(t *testing.T, device uuid.UUID, key signature.DeviceKey) {
+	t.Helper()
+
+	certificates, err := cryptic.ParseCertificates(key.Certificate)
+	require.NoError(t, err, "key %d has no certificate", key.Version)
+
+	public, err := cryptic.ParsePublicKey(key.PublicKey)
+	require.NoError(t, err)
+
+	certificate := certificates[0]
+	assert.Equal(t, public, certificate.PublicKey, "key %d certificate is issued for another key", key.Version)
+	assert.Equal(t, device.String(), certificate.Subject.CommonName, "key %d certificate names another device", key.Version)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(Authority(t).Certificate())
+
+	_, err = certificate.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: certificate.NotBefore, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	assert.NoError(t, err, "key %d certificate is not issued by the test CA", key.Version)
+}
+
+func assertDevices(t *testing.T, expected, actual []signature.Device, name string) {
+	t.Helper()
+
+	keys := func(devices []signature.Device) []uuid.UUID {
+		result := make([]uuid.UUID, len(devices))
+		for i, device := range devices {
+			result[i] = device.Key
+		}
+
+		return result
+	}
+
+	assert.Equal(t, keys(expected), keys(actual), name)
+}
+
+func reversed(devices []signature.Device) []signature.Device {
+	result := slices.Clone(devices)
+	slices.Reverse(result)
+
+	return result
+}
+
+func createDevice(t *testing.T, s signature.Storage, algorithm signature.Algorithm) signature.Device {
+	t.Helper()
+
+	device, err := s.CreateDevice(context.Background(), signature.CreateDeviceInput{Key: uuid.New(), Algorithm: algorithm, Label: "device"})
+	require.NoError(t, err)
+
+	return device
+}
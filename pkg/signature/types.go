@@ -6,17 +6,21 @@ package signature
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
 	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
 
-// Algorithm represents the cryptographic algorithm used for the signature device (ECC or RSA).
+// Algorithm represents the name of the cryptographic algorithm used for the signature device.
+// Valid names are the ones registered in `cryptic`, the constants below are only shortcuts for the built-in algorithms.
 type Algorithm string
 
 const (
-	ECC Algorithm = "ECC"
-	RSA Algorithm = "RSA"
+	ECC     Algorithm = "ECC"
+	RSA     Algorithm = "RSA"
+	ED25519 Algorithm = "ED25519"
 )
 
 func (a *Algorithm) UnmarshalJSON(data []byte) error {
@@ -25,8 +29,8 @@ func (a *Algorithm) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("error unmarshalling Algorithm: %w", err)
 	}
 
-	if name != "ECC" && name != "RSA" {
-		return ErrInvalidAlgorithm
+	if _, err := lookupAlgorithm(Algorithm(name)); err != nil {
+		return err
 	}
 
 	*a = Algorithm(name)
@@ -74,19 +78,192 @@ func (d *Data) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// Device represents a signature device, which includes cryptographic keys, algorithm, label, counter, and associated transactions.
+// DeviceStatus represents the lifecycle state of a signature device, only active devices can sign transactions.
+// Suspended devices can be reactivated, decommissioned devices are taken out of service for good.
+// Transactions of a device stay readable in every state.
+type DeviceStatus string
+
+const (
+	StatusActive         DeviceStatus = "active"
+	StatusSuspended      DeviceStatus = "suspended"
+	StatusDecommissioned DeviceStatus = "decommissioned"
+)
+
+// transitions lists states each state can change to.
+var transitions = map[DeviceStatus][]DeviceStatus{
+	StatusActive:         {StatusSuspended, StatusDecommissioned},
+	StatusSuspended:      {StatusActive, StatusDecommissioned},
+	StatusDecommissioned: {},
+}
+
+// CanChangeTo tells whether the device in this state can change to the next state.
+func (s DeviceStatus) CanChangeTo(next DeviceStatus) bool {
+	return slices.Contains(transitions[s], next)
+}
+
+// Actor represents who changed the state of a device, with validation for length (1-255).
+type Actor string
+
+func (a *Actor) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("error unmarshalling Actor: %w", err)
+	}
+
+	count := utf8.RuneCountInString(name)
+	if count < 1 || count > 255 {
+		return ErrInvalidActor
+	}
+
+	*a = Actor(name)
+
+	return nil
+}
+
+// DeviceSort represents the field devices are ordered by when listed, ties are always broken by the device key.
+type DeviceSort string
+
+const (
+	SortByCreatedAt DeviceSort = "createdAt"
+	SortByLabel     DeviceSort = "label"
+	SortByCounter   DeviceSort = "counter"
+)
+
+// ParseDeviceSort validates the name of a sort field, an empty name sorts by creation time.
+func ParseDeviceSort(name string) (DeviceSort, error) {
+	switch sort := DeviceSort(name); sort {
+	case "":
+		return SortByCreatedAt, nil
+	case SortByCreatedAt, SortByLabel, SortByCounter:
+		return sort, nil
+	default:
+		return "", ErrInvalidSort
+	}
+}
+
+// DeviceCursor represents the position of the last device on a page, the next page starts right after it.
+// It holds every sortable field, so the same cursor type works for all sort orders.
+type DeviceCursor struct {
+	Key       uuid.UUID `json:"key"`
+	CreatedAt time.Time `json:"createdAt"`
+	Label     Label     `json:"label"`
+	Counter   int64     `json:"counter"`
+}
+
+// NewDeviceCursor creates a cursor positioned at the device.
+func NewDeviceCursor(device Device) DeviceCursor {
+	return DeviceCursor{
+		Key:       device.Key,
+		CreatedAt: device.CreatedAt,
+		Label:     device.Label,
+		Counter:   device.Counter,
+	}
+}
+
+// Device represents a signature device, which includes cryptographic keys, algorithm, label and counter.
+// Transactions of the device are stored separately and listed page by page.
+// The key handle is never serialized, handlers respond with `DeviceResponse` instead.
 type Device struct {
-	Key          uuid.UUID     `json:"key"`
-	PublicKey    []byte        `json:"publicKey"`
-	PrivateKey   []byte        `json:"privateKey"`
-	Algorithm    Algorithm     `json:"algorithm"`
-	Label        Label         `json:"label"`
-	Counter      int64         `json:"counter"`
-	Transactions []Transaction `json:"transactions"`
+	Key       uuid.UUID `json:"key"`
+	PublicKey []byte    `json:"publicKey"`
+	// KeyHandle references the private key in the `cryptic.KeyStore`, for the software keystore it is the private key itself.
+	// It is encrypted with the data key, which is wrapped by the master key of the `Keyring` with MasterKeyID.
+	KeyHandle   []byte    `json:"-"`
+	DataKey     []byte    `json:"-"`
+	MasterKeyID string    `json:"-"`
+	Algorithm   Algorithm `json:"algorithm"`
+	// Bits is the modulus size of RSA keys and Curve the curve of ECDSA keys, both are empty for other algorithms.
+	Bits  int    `json:"bits"`
+	Curve string `json:"curve"`
+	// Scheme is the RSA signature scheme, Hash the hash function data is signed with and Encoding the encoding of ECDSA signatures,
+	// empty values select the defaults.
+	Scheme    string    `json:"scheme"`
+	Hash      string    `json:"hash"`
+	Encoding  string    `json:"encoding"`
+	Label     Label     `json:"label"`
+	Counter   int64     `json:"counter"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Status is the lifecycle state, with the time and the actor of its last change.
+	Status          DeviceStatus `json:"status"`
+	StatusChangedAt time.Time    `json:"statusChangedAt"`
+	StatusChangedBy Actor        `json:"statusChangedBy"`
+	// ImportedCounter is the counter the device was migrated with from another system, which kept earlier transactions.
+	// ImportedSignature is the base64 encoded last signature of that system, chained into the first transaction here.
+	ImportedCounter   int64  `json:"importedCounter"`
+	ImportedSignature string `json:"importedSignature"`
+	// RetiredKeys are the previous public keys of the device ordered by version, the current key signs from the counter the last one stopped at.
+	RetiredKeys []DeviceKey `json:"retiredKeys"`
+	// Certificate is the PEM encoded X.509 certificate of the current key, empty for devices created before certificates were issued.
+	Certificate []byte `json:"certificate"`
 }
 
-// Transaction represents a transaction containing signed data and the corresponding signature.
+// KeyAt returns the public key which signed the transaction with the counter.
+// Counters not covered by any retired key belong to the current key.
+func (d Device) KeyAt(counter int64) DeviceKey {
+	for _, key := range d.RetiredKeys {
+		if counter >= key.From && counter < key.To {
+			return key
+		}
+	}
+
+	return d.CurrentKey()
+}
+
+// CurrentKey returns the public key the device signs with now, its range is open ended so To is zero.
+// The first key of an imported device starts at the imported counter.
+func (d Device) CurrentKey() DeviceKey {
+	key := DeviceKey{
+		Version:     len(d.RetiredKeys) + 1,
+		Algorithm:   d.Algorithm,
+		Bits:        d.Bits,
+		Curve:       d.Curve,
+		Scheme:      d.Scheme,
+		Hash:        d.Hash,
+		Encoding:    d.Encoding,
+		PublicKey:   d.PublicKey,
+		Certificate: d.Certificate,
+		From:        d.ImportedCounter,
+	}
+
+	if len(d.RetiredKeys) > 0 {
+		key.From = d.RetiredKeys[len(d.RetiredKeys)-1].To
+	}
+
+	return key
+}
+
+// DeviceKey represents a public key of a device with the range of signature counters it signed, From inclusive and To exclusive.
+// A key rotated before signing anything has an empty range. The certificate of a retired key is revoked as superseded at RotatedAt.
+type DeviceKey struct {
+	Version     int       `json:"version"`
+	Algorithm   Algorithm `json:"algorithm"`
+	Bits        int       `json:"bits,omitempty"`
+	Curve       string    `json:"curve,omitempty"`
+	Scheme      string    `json:"scheme,omitempty"`
+	Hash        string    `json:"hash,omitempty"`
+	Encoding    string    `json:"encoding,omitempty"`
+	PublicKey   []byte    `json:"publicKey"`
+	Certificate []byte    `json:"certificate,omitempty"`
+	From        int64     `json:"from"`
+	To          int64     `json:"to"`
+	RotatedAt   time.Time `json:"rotatedAt"`
+}
+
+// Transaction represents a transaction containing signed data and the corresponding base64 encoded signature.
+// Signed data follows the format `<signature_counter>_<data_to_be_signed>_<last_signature_base64_encoded>`.
+// Algorithm, Scheme, Hash and Encoding tell how the signature is checked, options the algorithm has none of are empty.
 type Transaction struct {
-	Signature  string `json:"signature"`
-	SignedData string `json:"signedData"`
+	Counter    int64     `json:"counter"`
+	Signature  string    `json:"signature"`
+	SignedData string    `json:"signedData"`
+	Algorithm  Algorithm `json:"algorithm,omitempty"`
+	Scheme     string    `json:"scheme,omitempty"`
+	Hash       string    `json:"hash,omitempty"`
+	Encoding   string    `json:"encoding,omitempty"`
+}
+
+// Verification represents the result of checking a signature against the public key of a device.
+type Verification struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason,omitempty"`
 }
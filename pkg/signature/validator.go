@@ -0,0 +1,341 @@
+package signature
+
+// validator.go implements a middleware validating requests, and optionally responses, against the OpenAPI spec of the service.
+// Requests which do not match the spec are answered with problem details before they reach the handlers. Constraints of fields
+// which the handlers check as well report the same sentinel errors, so clients get the same codes whichever check fails first.
+// Responses are validated in tests to keep the spec and the handlers from drifting apart, a mismatch is answered with a 500.
+// Request bodies are read up to the largest one the spec allows, exports streamed as JSON lines are passed on without being validated.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// maxBodySize limits request bodies to the largest one the spec allows: a full batch of data items of 1024 characters,
+// each escaped as a JSON surrogate pair at worst, with room for the rest of the body. Larger bodies are not read.
+const maxBodySize = MaxBatchSize*1024*12 + 64<<10
+
+// fieldErrors are the sentinel errors of request fields the handlers check as well, by where the field is and its name.
+// Items of arrays share the name of the array with `[]` appended.
+var fieldErrors = map[string]error{
+	InQuery + ":algorithm":        ErrInvalidAlgorithm,
+	InQuery + ":status":           ErrInvalidStatus,
+	InQuery + ":sort":             ErrInvalidSort,
+	InQuery + ":order":            ErrInvalidOrder,
+	InQuery + ":cursor":           ErrInvalidCursor,
+	InQuery + ":limit":            ErrInvalidLimit,
+	InHeader + ":Idempotency-Key": ErrInvalidIdempotencyKey,
+	InBody + ":algorithm":         ErrInvalidAlgorithm,
+	InBody + ":label":             ErrLabelTooLong,
+	InBody + ":bits":              cryptic.ErrInvalidKeyParams,
+	InBody + ":curve":             cryptic.ErrInvalidKeyParams,
+	InBody + ":scheme":            cryptic.ErrInvalidSignatureOptions,
+	InBody + ":hash":              cryptic.ErrInvalidSignatureOptions,
+	InBody + ":encoding":          cryptic.ErrInvalidSignatureOptions,
+	InBody + ":counter":           ErrInvalidChain,
+	InBody + ":lastSignature":     ErrSignatureNotBase64,
+	InBody + ":signature":         ErrSignatureNotBase64,
+	InBody + ":changedBy":         ErrInvalidActor,
+	InBody + ":data":              ErrDataIncorrectSize,
+	InBody + ":data[]":            ErrDataIncorrectSize,
+}
+
+// Media types of responses which are not JSON are checked as text or binary, their content is up to the handlers.
+func init() {
+	openapi3filter.RegisterBodyDecoder(MediaTypeJWK, openapi3filter.JSONBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(MediaTypeJWKSet, openapi3filter.JSONBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(MediaTypeJSONL, openapi3filter.PlainBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(MediaTypePEM, openapi3filter.PlainBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(MediaTypePEMChain, openapi3filter.PlainBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(MediaTypeCertificate, openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(MediaTypeCRL, openapi3filter.FileBodyDecoder)
+}
+
+// Validator checks requests against the OpenAPI spec before passing them to the next handler.
+type Validator struct {
+	next      http.Handler
+	router    routers.Router
+	responses bool
+}
+
+// NewValidator creates a middleware validating requests to the next handler against the YAML or JSON OpenAPI spec,
+// with responses the responses of the next handler are validated as well. Paths are matched as the spec has them,
+// the middleware goes in front of any prefix stripping.
+func NewValidator(spec []byte, next http.Handler, responses bool) (*Validator, error) {
+	document, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("error loading openapi spec: %w", err)
+	}
+
+	router, err := gorillamux.NewRouter(document)
+	if err != nil {
+		return nil, fmt.Errorf("error routing openapi spec: %w", err)
+	}
+
+	return &Validator{next: next, router: router, responses: responses}, nil
+}
+
+// ServeHTTP validates the request and passes it on. Requests to paths the spec does not know are passed on as they are,
+// the next handler answers them. Bodies are read once, the next handler gets them as they were sent.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, params, err := v.router.FindRoute(r)
+	if err != nil {
+		v.next.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, r, fmt.Errorf("%w, it can have at most %d bytes", ErrBodyTooLarge, tooLarge.Limit))
+			return
+		}
+
+		writeProblem(w, r, fmt.Errorf("%w: %w", ErrMalformedBody, err))
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// The handlers decode bodies as JSON whatever their Content-Type, e.g. bodies sent by curl -d, so they are validated as JSON.
+	validation := r.Clone(r.Context())
+	validation.Header.Set("Content-Type", "application/json")
+	validation.Body = io.NopCloser(bytes.NewReader(body))
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    validation,
+		PathParams: params,
+		Route:      route,
+		Options:    &openapi3filter.Options{MultiError: true, SkipSettingDefaults: true, IncludeResponseStatus: true},
+	}
+
+	if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+		writeValidationProblem(w, r, err)
+		return
+	}
+
+	if !v.responses {
+		v.next.ServeHTTP(w, r)
+		return
+	}
+
+	response := &recordedResponse{w: w, header: http.Header{}, status: http.StatusOK}
+	v.next.ServeHTTP(response, r)
+
+	if response.streamed {
+		return
+	}
+
+	err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 response.status,
+		Header:                 response.header,
+		Body:                   io.NopCloser(bytes.NewReader(response.body.Bytes())),
+		Options:                input.Options,
+	})
+	if err != nil {
+		// The response is not sent, it is logged and the mismatch is told as it is, which is fine as only tests validate responses.
+		log.Printf("%s %s: response %d does not match the openapi spec: %v", r.Method, r.URL.Path, response.status, err)
+
+		problem := newProblem(err)
+		problem.Detail = fmt.Sprintf("response %d does not match the openapi spec: %v", response.status, err)
+		problem.Instance = r.URL.Path
+
+		writeProblemDetails(w, problem)
+
+		return
+	}
+
+	maps.Copy(w.Header(), response.header)
+	w.WriteHeader(response.status)
+	_, _ = response.body.WriteTo(w)
+}
+
+// writeValidationProblem writes the problem of a request which does not match the spec, the first error decides the problem
+// and all of them are listed as field errors.
+func writeValidationProblem(w http.ResponseWriter, r *http.Request, err error) {
+	var problem Problem
+
+	for i, fieldErr := range validationErrors(err) {
+		if i == 0 {
+			problem = newProblem(fieldErr)
+			problem.Instance = r.URL.Path
+			problem.Errors = nil
+		}
+
+		var field *fieldError
+		if errors.As(fieldErr, &field) && field.field != "" {
+			problem.Errors = append(problem.Errors, FieldError{In: field.in, Field: field.field, Message: fieldErr.Error()})
+		}
+	}
+
+	writeProblemDetails(w, problem)
+}
+
+// validationErrors turns the errors of validating a request into errors of fields, wrapping the sentinel errors of the fields.
+// Errors are told apart by their types, as multi errors match any type one of their errors has.
+func validationErrors(err error) []error {
+	switch err := err.(type) {
+	case openapi3.MultiError:
+		var result []error
+
+		for _, err := range err {
+			result = append(result, validationErrors(err)...)
+		}
+
+		return result
+	case *openapi3filter.RequestError:
+		if err.Parameter != nil {
+			in, name := err.Parameter.In, err.Parameter.Name
+
+			return []error{invalidField(in, name, fieldFailure(in, name, reason(err)))}
+		}
+
+		return bodyErrors(err.Err)
+	default:
+		return []error{err}
+	}
+}
+
+// bodyErrors turns the errors of validating the body into errors of its fields, several of them when it was valid JSON.
+func bodyErrors(err error) []error {
+	switch err := err.(type) {
+	case openapi3.MultiError:
+		var result []error
+
+		for _, err := range err {
+			result = append(result, bodyErrors(err)...)
+		}
+
+		return result
+	case *openapi3.SchemaError:
+		name := fieldName(err.JSONPointer())
+
+		switch err.SchemaField {
+		case "type":
+			// Types are checked by the decoder of the handlers as well, their errors are no sentinel errors there either.
+			return []error{invalidField(InBody, name, fmt.Errorf("%s: %s", name, err.Reason))}
+		case "minItems", "maxItems":
+			// Batches are the only arrays of a limited size.
+			return []error{invalidField(InBody, name, fmt.Errorf("%w: %s", ErrInvalidBatchSize, err.Reason))}
+		default:
+			return []error{invalidField(InBody, name, fieldFailure(InBody, name, err.Reason))}
+		}
+	case nil:
+		return []error{ErrMalformedBody}
+	default:
+		return []error{fmt.Errorf("%w: %w", ErrMalformedBody, err)}
+	}
+}
+
+// fieldFailure wraps the sentinel error of the field, if there is any, with the reason it did not validate.
+// Without one the reason is told with the name of the field, sentinel errors name it themselves.
+func fieldFailure(in, name, reason string) error {
+	key := in + ":" + name
+	if index := strings.IndexByte(name, '['); index >= 0 {
+		key = in + ":" + name[:index] + "[]"
+	}
+
+	if sentinel, ok := fieldErrors[key]; ok {
+		return fmt.Errorf("%w: %s", sentinel, reason)
+	}
+
+	if name == "" {
+		return errors.New(reason)
+	}
+
+	return fmt.Errorf("%s: %s", name, reason)
+}
+
+// reason tells why the parameter or body did not validate, without the context the error message adds.
+func reason(err *openapi3filter.RequestError) string {
+	var schema *openapi3.SchemaError
+	if errors.As(err.Err, &schema) {
+		return schema.Reason
+	}
+
+	if err.Err != nil {
+		return err.Err.Error()
+	}
+
+	return err.Reason
+}
+
+// fieldName joins the JSON pointer of a body field to the names field errors use, e.g. data[1].
+func fieldName(pointer []string) string {
+	var name strings.Builder
+
+	for _, part := range pointer {
+		if _, err := strconv.Atoi(part); err == nil {
+			name.WriteString("[" + part + "]")
+			continue
+		}
+
+		if name.Len() > 0 {
+			name.WriteString(".")
+		}
+
+		name.WriteString(part)
+	}
+
+	return name.String()
+}
+
+// recordedResponse keeps the response of the next handler until it is validated. Exports are streamed to the writer as they are
+// written instead, buffering them would keep whole chains in memory.
+type recordedResponse struct {
+	w        http.ResponseWriter
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	wrote    bool
+	streamed bool
+}
+
+func (r *recordedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *recordedResponse) WriteHeader(status int) {
+	if r.wrote {
+		return
+	}
+
+	r.status, r.wrote = status, true
+
+	if r.header.Get("Content-Type") == MediaTypeJSONL {
+		r.streamed = true
+
+		maps.Copy(r.w.Header(), r.header)
+		r.w.WriteHeader(status)
+	}
+}
+
+func (r *recordedResponse) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+
+	if r.streamed {
+		return r.w.Write(data)
+	}
+
+	// Handlers writing without a Content-Type get it sniffed, as the server would.
+	if r.header.Get("Content-Type") == "" {
+		r.header.Set("Content-Type", http.DetectContentType(data))
+	}
+
+	return r.body.Write(data)
+}
@@ -0,0 +1,317 @@
+package signature_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/cryptic"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/docs"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/pkg/signature/storagetest"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newValidatedHandler serves the handler of a memory storage as cmd/web does, validating requests and responses against the spec.
+func newValidatedHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	authority := storagetest.Authority(t)
+	store := signature.NewMemory(cryptic.NewSoftwareKeyStore(), storagetest.NewKeyring(t, "first"), cryptic.DefaultKeyPolicy(), authority)
+	handler := http.StripPrefix("/signature", signature.NewHandler(store, authority, signature.DefaultIdempotencyWindow))
+
+	validator, err := signature.NewValidator(docs.Spec(), handler, true)
+	require.NoError(t, err)
+
+	return validator
+}
+
+func TestValidator_Operations(t *testing.T) {
+	t.Parallel()
+
+	handler := newValidatedHandler(t)
+	covered := map[string]bool{}
+
+	call := func(operation, method, target, body string, status int, header ...string) []byte {
+		t.Helper()
+
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			request.Header.Set(header[i], header[i+1])
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		require.Equal(t, status, recorder.Code, "%s %s: %s", method, target, recorder.Body.String())
+
+		covered[operation] = true
+
+		return recorder.Body.Bytes()
+	}
+
+	key := uuid.NewString()
+	device := "/signature/device/" + key
+
+	call("createDevice", http.MethodPost, "/signature/device", `{"key":"`+key+`","algorithm":"ECC","label":"validated"}`, http.StatusCreated)
+	call("createDevice", http.MethodPost, "/signature/device", `{"key":"`+key+`","algorithm":"ECC"}`, http.StatusConflict)
+	call("createDevice", http.MethodPost, "/signature/device", `{"key":`, http.StatusBadRequest)
+	call("createDevice", http.MethodPost, "/signature/device", `{"key":"`+uuid.NewString()+`","algorithm":"DSA"}`, http.StatusUnprocessableEntity)
+	call("listDevices", http.MethodGet, "/signature/device?limit=1&sort=label&order=desc", "", http.StatusOK)
+	call("listDevices", http.MethodGet, "/signature/device?limit=0", "", http.StatusBadRequest)
+	call("findDevice", http.MethodGet, device, "", http.StatusOK)
+	call("findDevice", http.MethodGet, "/signature/device/"+uuid.NewString(), "", http.StatusNotFound)
+
+	transaction := call("createTransaction", http.MethodPost, "/signature/transaction", `{"deviceKey":"`+key+`","data":"receipt"}`, http.StatusCreated,
+		"Idempotency-Key", "retry-1")
+	call("createTransaction", http.MethodPost, "/signature/transaction", `{"deviceKey":"`+key+`","data":"other"}`, http.StatusUnprocessableEntity,
+		"Idempotency-Key", "retry-1")
+
+	other := uuid.NewString()
+
+	call("createDevice", http.MethodPost, "/signature/device", `{"key":"`+other+`","algorithm":"ED25519"}`, http.StatusCreated)
+	call("createTransaction", http.MethodPost, "/signature/transaction", `{"deviceKey":"`+other+`","data":"receipt"}`, http.StatusUnprocessableEntity,
+		"Idempotency-Key", "retry-1")
+	call("createTransactions", http.MethodPost, device+"/transactions:batch", `{"data":["first","second"]}`, http.StatusCreated)
+	call("createTransactions", http.MethodPost, device+"/transactions:batch", `{"data":[]}`, http.StatusUnprocessableEntity)
+	call("listTransactions", http.MethodGet, device+"/transactions?limit=2", "", http.StatusOK)
+	call("findTransaction", http.MethodGet, device+"/transactions/0", "", http.StatusOK)
+	call("findTransaction", http.MethodGet, device+"/transactions/99", "", http.StatusNotFound)
+
+	var signed signature.Transaction
+	require.NoError(t, json.Unmarshal(transaction, &signed))
+
+	verify, err := json.Marshal(map[string]string{"deviceKey": key, "signedData": signed.SignedData, "signature": signed.Signature})
+	require.NoError(t, err)
+
+	call("verifySignature", http.MethodPost, "/signature/verify", string(verify), http.StatusOK)
+	call("getPublicKey", http.MethodGet, device+"/public-key", "", http.StatusOK)
+	call("getPublicKey", http.MethodGet, device+"/public-key", "", http.StatusOK, "Accept", signature.MediaTypePEM)
+	call("getPublicKey", http.MethodGet, device+"/public-key", "", http.StatusNotAcceptable, "Accept", "text/html")
+	call("listJWKS", http.MethodGet, "/signature/jwks", "", http.StatusOK)
+	call("getDeviceCertificate", http.MethodGet, device+"/certificate", "", http.StatusOK)
+	call("getDeviceCertificate", http.MethodGet, device+"/certificate", "", http.StatusOK, "Accept", signature.MediaTypeCertificate)
+	call("getCertificateAuthority", http.MethodGet, "/signature/ca", "", http.StatusOK)
+	call("auditDevice", http.MethodGet, device+"/audit", "", http.StatusOK)
+	call("exportDeviceChain", http.MethodGet, device+"/export", "", http.StatusOK)
+	call("rotateDeviceKey", http.MethodPost, device+"/rotate", "", http.StatusOK)
+	call("rotateDeviceKey", http.MethodPost, device+"/rotate", `{"algorithm":"ED25519"}`, http.StatusOK)
+	call("deactivateDevice", http.MethodPost, device+"/deactivate", `{"changedBy":"auditor"}`, http.StatusOK)
+	call("createTransaction", http.MethodPost, "/signature/transaction", `{"deviceKey":"`+key+`","data":"receipt"}`, http.StatusConflict)
+	call("reactivateDevice", http.MethodPost, device+"/reactivate", `{"changedBy":"auditor"}`, http.StatusOK)
+	call("reactivateDevice", http.MethodPost, device+"/reactivate", `{"changedBy":"auditor"}`, http.StatusConflict)
+	call("decommissionDevice", http.MethodPost, device+"/decommission", `{}`, http.StatusUnprocessableEntity)
+	call("decommissionDevice", http.MethodPost, device+"/decommission", `{"changedBy":"auditor"}`, http.StatusOK)
+	call("getRevocationList", http.MethodGet, "/signature/crl", "", http.StatusOK)
+
+	document, err := openapi3.NewLoader().LoadFromData(docs.Spec())
+	require.NoError(t, err)
+
+	for path, item := range document.Paths.Map() {
+		for method, operation := range item.Operations() {
+			assert.True(t, covered[operation.OperationID], "%s %s (%s) is not exercised", method, path, operation.OperationID)
+		}
+	}
+}
+
+func TestValidator_Requests(t *testing.T) {
+	t.Parallel()
+
+	handler := newValidatedHandler(t)
+	key := uuid.NewString()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		header string
+		status int
+		code   string
+		fields []signature.FieldError
+	}{
+		{
+			"Label too long", http.MethodPost, "/signature/device", `{"key":"` + key + `","algorithm":"ECC","label":"` + strings.Repeat("x", 256) + `"}`, "",
+			http.StatusUnprocessableEntity, "label_too_long", []signature.FieldError{{In: signature.InBody, Field: "label"}},
+		},
+		{
+			"Several fields", http.MethodPost, "/signature/device", `{"key":"` + key + `","algorithm":"DSA","curve":"P-192"}`, "",
+			http.StatusUnprocessableEntity, "invalid_algorithm",
+			[]signature.FieldError{{In: signature.InBody, Field: "algorithm"}, {In: signature.InBody, Field: "curve"}},
+		},
+		{
+			"Field of wrong type", http.MethodPost, "/signature/device", `{"key":"` + key + `","algorithm":"ECC","counter":"many"}`, "",
+			http.StatusUnprocessableEntity, signature.CodeValidationFailed, []signature.FieldError{{In: signature.InBody, Field: "counter"}},
+		},
+		{
+			"Missing actor", http.MethodPost, "/signature/device/" + key + "/deactivate", `{}`, "",
+			http.StatusUnprocessableEntity, "invalid_actor", []signature.FieldError{{In: signature.InBody, Field: "changedBy"}},
+		},
+		{
+			"Missing body", http.MethodPost, "/signature/transaction", "", "", http.StatusBadRequest, signature.CodeMalformedBody, nil,
+		},
+		{
+			"Malformed body", http.MethodPost, "/signature/transaction", `{"deviceKey":`, "", http.StatusBadRequest, signature.CodeMalformedBody, nil,
+		},
+		{
+			"Batch too large", http.MethodPost, "/signature/device/" + key + "/transactions:batch", `{"data":[` + strings.Repeat(`"data",`, 100) + `"data"]}`, "",
+			http.StatusUnprocessableEntity, "invalid_batch_size", []signature.FieldError{{In: signature.InBody, Field: "data"}},
+		},
+		{
+			"Invalid batch item", http.MethodPost, "/signature/device/" + key + "/transactions:batch", `{"data":["data","x"]}`, "",
+			http.StatusUnprocessableEntity, "invalid_data_size", []signature.FieldError{{In: signature.InBody, Field: "data[1]"}},
+		},
+		{
+			"Invalid idempotency key", http.MethodPost, "/signature/transaction", `{"deviceKey":"` + key + `","data":"data"}`, strings.Repeat("k", 256),
+			http.StatusBadRequest, "invalid_idempotency_key", []signature.FieldError{{In: signature.InHeader, Field: "Idempotency-Key"}},
+		},
+		{
+			"Invalid status", http.MethodGet, "/signature/device?status=retired", "", "",
+			http.StatusBadRequest, "invalid_status", []signature.FieldError{{In: signature.InQuery, Field: "status"}},
+		},
+		{
+			"Invalid cursor", http.MethodGet, "/signature/device/" + key + "/transactions?cursor=-1", "", "",
+			http.StatusBadRequest, "invalid_cursor", []signature.FieldError{{In: signature.InQuery, Field: "cursor"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			if test.header != "" {
+				request.Header.Set("Idempotency-Key", test.header)
+			}
+
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, request)
+
+			require.Equal(t, test.status, recorder.Code, recorder.Body.String())
+			assert.Equal(t, signature.MediaTypeProblem, recorder.Header().Get("Content-Type"))
+
+			var problem signature.Problem
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&problem))
+			assert.Equal(t, test.code, problem.Code)
+			assert.Equal(t, test.status, problem.Status)
+			require.Len(t, problem.Errors, len(test.fields), problem.Errors)
+
+			for i, expected := range test.fields {
+				assert.Equal(t, expected.In, problem.Errors[i].In)
+				assert.Equal(t, expected.Field, problem.Errors[i].Field)
+				assert.NotEmpty(t, problem.Errors[i].Message)
+			}
+		})
+	}
+}
+
+func TestValidator_BodySize(t *testing.T) {
+	t.Parallel()
+
+	handler := newValidatedHandler(t)
+	key := uuid.NewString()
+
+	call := func(target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+
+		return recorder
+	}
+
+	require.Equal(t, http.StatusCreated, call("/signature/device", `{"key":"`+key+`","algorithm":"ED25519"}`).Code)
+
+	// The largest body the spec allows is a full batch of the largest items, with every character escaped as a surrogate pair.
+	item := `"` + strings.Repeat(`\ud83d\ude00`, 1024) + `"`
+	largest := `{"data":[` + strings.Repeat(item+",", signature.MaxBatchSize-1) + item + `]}`
+
+	recorder := call("/signature/device/"+key+"/transactions:batch", largest)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = call("/signature/device/"+key+"/transactions:batch", largest+strings.Repeat(" ", 64<<10+1))
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	var problem signature.Problem
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&problem))
+	assert.Equal(t, "body_too_large", problem.Code)
+}
+
+func TestValidator_StreamedExports(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+
+	// Lines of an export reach the client while the chain is still being written.
+	exporting := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", signature.MediaTypeJSONL)
+
+		_, _ = w.Write([]byte("{\"counter\":0}\n"))
+		assert.Equal(t, "{\"counter\":0}\n", recorder.Body.String())
+
+		_, _ = w.Write([]byte("{\"counter\":1}\n"))
+	})
+
+	validator, err := signature.NewValidator(docs.Spec(), exporting, true)
+	require.NoError(t, err)
+
+	validator.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/signature/device/"+uuid.NewString()+"/export", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, signature.MediaTypeJSONL, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"counter\":0}\n{\"counter\":1}\n", recorder.Body.String())
+}
+
+func TestValidator_Responses(t *testing.T) {
+	t.Parallel()
+
+	// A handler which drifted from the spec, counters became strings and devices are listed with an undocumented status.
+	drifted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/signature/device" {
+			w.WriteHeader(http.StatusAccepted)
+		}
+
+		_, _ = w.Write([]byte(`{"counter":"one"}`))
+	})
+
+	tests := []struct {
+		name      string
+		target    string
+		responses bool
+		status    int
+	}{
+		{"Undocumented status", "/signature/device", true, http.StatusInternalServerError},
+		{"Response not matching the schema", "/signature/device/" + uuid.NewString(), true, http.StatusInternalServerError},
+		{"Responses not validated", "/signature/device", false, http.StatusAccepted},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			validator, err := signature.NewValidator(docs.Spec(), drifted, test.responses)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+
+			validator.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+			require.Equal(t, test.status, recorder.Code, recorder.Body.String())
+
+			if test.status == http.StatusInternalServerError {
+				var problem signature.Problem
+				require.NoError(t, json.NewDecoder(recorder.Body).Decode(&problem))
+				assert.Equal(t, signature.CodeInternalError, problem.Code)
+				assert.Contains(t, problem.Detail, "does not match the openapi spec")
+			}
+		})
+	}
+}